@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"go-template/internal/config"
+	"go-template/internal/migrate"
+	"go-template/migrations"
+)
+
+const usage = `Usage: migrate [-dir migrations] [-config file] [-env profile] <command>
+
+Commands:
+  up            apply all pending migrations
+  down N        revert the N most recently applied migrations
+  status        list migrations and when they were applied
+  create NAME   write a new empty up/down migration pair to -dir
+
+The database is read from the application config (database.dsn, usually
+POSTGRES_CONN; a .env file is loaded if present). Only the database section
+is validated, the other settings may be left unset.
+`
+
+func main() {
+	dir := flag.String("dir", "migrations", "directory new migrations are created in")
+	configFile := flag.String("config", "", "config file")
+	env := flag.String("env", "", "environment profile")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// create only writes files and needs no database
+	if args[0] == "create" {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		paths, err := migrate.Create(*dir, args[1])
+		if err != nil {
+			log.Fatalf("create failed: %v", err)
+		}
+		for _, p := range paths {
+			fmt.Println("created", p)
+		}
+		return
+	}
+
+	godotenv.Load()
+	var configArgs []string
+	if *configFile != "" {
+		configArgs = append(configArgs, "-config", *configFile)
+	}
+	if *env != "" {
+		configArgs = append(configArgs, "-env", *env)
+	}
+	dbCfg, err := config.LoadDatabase(configArgs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("postgres", dbCfg.DSN)
+	if err != nil {
+		log.Fatalf("Database connection failed: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("Loading migrations failed: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %06d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("up failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			log.Fatalf("down needs a positive number of migrations, got %q", args[1])
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %06d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("down failed: %v", err)
+		}
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatalf("status failed: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
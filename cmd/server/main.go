@@ -1,22 +1,49 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 
 	docs "go-template/docs"
+	"go-template/internal/app"
+	audithandler "go-template/internal/audit/handler"
+	"go-template/internal/auth"
+	"go-template/internal/config"
 	"go-template/internal/db"
+	"go-template/internal/health"
+	"go-template/internal/logging"
+	"go-template/internal/metrics"
 	"go-template/internal/middleware"
 	orderhandler "go-template/internal/order/handler"
+	"go-template/internal/outbox/broker"
+	"go-template/internal/outbox/relay"
+	"go-template/internal/policy"
 	userhandler "go-template/internal/user/handler"
 	"go-template/pkg/redisclient"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 // @title Example API
@@ -28,56 +55,268 @@ import (
 // @in header
 // @name Authorization
 func main() {
-	// Load environment variables
+	// Load .env into the environment, then merge defaults, config files,
+	// environment variables and flags into one validated config
 	godotenv.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Structured logs for the whole process; log.Printf output is routed here too
+	logger := logging.New(os.Stdout, cfg.Log)
+	slog.SetDefault(logger)
+
+	// Set up tracing first so every component below picks up the provider
+	shutdownTracing, err := setupTracing(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Tracing setup failed: %v", err)
+	}
 
 	// Example: Initialize sql.DB (legacy/original version)
 	// You can use this if you want to use the standard library database/sql API instead of GORM.
 	// By default, this project uses GORM for database operations, but you can switch to sql.DB if needed.
-	db.InitDB()
-	defer db.DB.Close()
+	sqlDB, err := db.Open(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Example: Initialize GORM DB (recommended/primary usage)
 	// This is the main database connection for most use cases in this project.
 	// If you want to use GORM's ORM features, use this connection.
-	gormDSN := os.Getenv("POSTGRES_CONN")
-	gormDB, err := gorm.Open(postgres.Open(gormDSN), &gorm.Config{})
+	// TranslateError turns constraint violations into gorm.ErrDuplicatedKey and
+	// gorm.ErrForeignKeyViolated, which repositories map to domain errors
+	gormDB, err := gorm.Open(postgres.Open(cfg.Database.DSN), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic("failed to connect to database (gorm): " + err.Error())
 	}
+	// Query spans record statements with placeholders, not argument values
+	if err := gormDB.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics(), gormtracing.WithoutQueryVariables())); err != nil {
+		panic("failed to enable tracing (gorm): " + err.Error())
+	}
+	gormPool, err := gormDB.DB()
+	if err != nil {
+		panic("failed to get database pool (gorm): " + err.Error())
+	}
+	db.ConfigurePool(gormPool, cfg.Database)
+	metrics.RegisterDBStats(sqlDB, "sql")
+	metrics.RegisterDBStats(gormPool, "gorm")
 
-	r := gin.Default()
-	// Middleware: Inject both DB into Gin Context
-	r.Use(func(c *gin.Context) {
-		c.Set("db", db.DB)
-		c.Set("gorm", gormDB)
-		c.Next()
+	// Redis is optional: without it the user cache is off and token state is
+	// kept in process memory
+	rdb := redisclient.New(redisclient.Options{
+		Addr:     cfg.Redis.Addr(),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
 
-	// Init Redis
-	redisclient.Init()
+	// Token issuing and revocation
+	tokens, err := auth.NewManagerFromConfig(cfg.Auth, rdb)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Role/permission policy
+	roles, err := policy.Load(cfg.Policy.File)
+	if err != nil {
+		log.Fatalf("Failed to load policy: %v", err)
+	}
+
+	// Build repositories, services and handlers once
+	application := app.New(app.Deps{DB: gormDB, Redis: rdb, Tokens: tokens, Policy: roles}, cfg.Users, logger)
 
-	// Public routes
-	r.POST("/login", userhandler.LoginHandler)
-	r.POST("/register", userhandler.RegisterUserHandler)
-	r.GET("/userwithcache/:id", userhandler.GetUserWithCacheHandler)
-	r.POST("/register_with_order", userhandler.RegisterUserWithOrderHandler)
+	// The access log runs inside the tracing middleware so its lines carry
+	// the trace id as well as the request id. Errors renders every failure,
+	// including recovered panics, as application/problem+json; it runs inside
+	// the access log and metrics so they see the final status.
+	r := gin.New()
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName), traceResponseHeader())
+	r.Use(middleware.RequestID(), middleware.AuditClient(), middleware.AccessLog(logger), metrics.Middleware())
+	r.Use(middleware.Errors(logger), middleware.Recovery(logger))
+	r.NoRoute(middleware.NotFound)
 
-	// Protected routes
-	authorized := r.Group("/user", middleware.AuthMiddleware())
-	{
-		authorized.GET("/:id", userhandler.GetUserHandler)
-		authorized.PUT("/:id", userhandler.UpdateUserHandler)
-		authorized.DELETE("/:id", userhandler.DeleteUserHandler)
-		authorized.GET("/:id/orders", userhandler.GetUserWithOrdersHandler)
+	// Publish domain events from the outbox (uses Redis Streams unless events.broker is memory)
+	eventRelay, err := newEventRelay(cfg.Events, application.TxManager, rdb, logger)
+	if err != nil {
+		log.Fatalf("Event relay setup failed: %v", err)
 	}
 
+	// Probes: /healthz only shows the process is up, /readyz checks dependencies.
+	// /metrics serves Prometheus metrics.
+	readiness := health.NewChecker(cfg.Health.CheckTimeout,
+		health.Check{Name: "database", Probe: sqlDB.PingContext},
+		health.Check{Name: "gorm", Probe: gormPool.PingContext},
+		health.Check{Name: "redis", Optional: true, Probe: redisclient.Ping(rdb)},
+	)
+	r.GET("/healthz", health.LivenessHandler)
+	r.GET("/metrics", metrics.Handler())
+	r.GET("/readyz", readiness.ReadinessHandler)
+
+	// User, auth and order APIs
+	userhandler.RegisterUserRoutes(r, application.UserHandler)
+	orderhandler.RegisterOrderRoutes(r, application.OrderHandler)
+	audithandler.RegisterAuditRoutes(r, application.AuditHandler)
+
 	// Swagger setup
 	docs.SwaggerInfo.BasePath = "/"
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Order API
-	orderhandler.RegisterOrderRoutes(r)
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	// Serve until SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests finish before closing the connection pools
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Purge users whose soft delete is older than the retention period
+	if cfg.Users.PurgeInterval > 0 {
+		go application.UserService.RunPurge(ctx, cfg.Users.PurgeInterval, cfg.Users.DeletedRetention)
+	}
+	if eventRelay != nil {
+		go eventRelay.Run(ctx, cfg.Events.PollInterval)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Listening", "addr", cfg.HTTP.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	r.Run(":8080")
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server failed", "error", err)
+		}
+	case <-ctx.Done():
+		stop()
+		logger.Info("Shutting down, waiting for in-flight requests", "timeout", cfg.HTTP.ShutdownTimeout.String())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Graceful shutdown did not finish", "error", err)
+		}
+	}
+
+	// Close pools only after the last request is done
+	if err := sqlDB.Close(); err != nil {
+		logger.Error("Closing sql.DB failed", "error", err)
+	}
+	if err := gormPool.Close(); err != nil {
+		logger.Error("Closing GORM pool failed", "error", err)
+	}
+	if err := redisclient.Close(rdb); err != nil {
+		logger.Error("Closing Redis failed", "error", err)
+	}
+	// Flush the remaining spans last
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Flushing traces failed", "error", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// newEventRelay builds the outbox relay for the configured broker. It returns
+// nil when the relay is disabled or Redis is unavailable; events then stay in
+// the outbox until an instance that can publish them picks them up. A memory
+// broker without subscribers is refused, it would mark events published that
+// nobody received.
+func newEventRelay(cfg config.EventsConfig, txManager db.TransactionManager, rdb *redis.Client, logger *slog.Logger) (*relay.Relay, error) {
+	if cfg.PollInterval == 0 {
+		return nil, nil
+	}
+	var b broker.Broker
+	switch cfg.Broker {
+	case "memory":
+		mb := broker.NewMemoryBroker()
+		// Subscribe the in-process consumers here
+		mb.Subscribe("*", broker.LogHandler(logger))
+		if !mb.HasSubscribers() {
+			return nil, errors.New("events.broker is memory but no handler is subscribed")
+		}
+		b = mb
+	default:
+		if rdb == nil {
+			logger.Warn("Redis unavailable, domain events are not published")
+			return nil, nil
+		}
+		b = broker.NewRedisStreamBroker(rdb, cfg.Stream, int64(cfg.StreamMaxLen))
+	}
+	return relay.New(txManager, b, logger).
+		WithBatchSize(cfg.BatchSize).
+		WithRetry(cfg.MaxAttempts, cfg.RetryBackoff, cfg.MaxRetryBackoff).
+		WithRetention(cfg.PublishedRetention), nil
+}
+
+// setupTracing installs the global tracer provider and W3C trace context
+// propagation. Spans are exported according to cfg.Tracing.Exporter:
+//   - otlp: OTLP/HTTP to tracing.endpoint (or OTEL_EXPORTER_OTLP_ENDPOINT)
+//   - stdout: pretty-printed JSON on stdout, for local runs
+//   - file: JSON lines appended to tracing.file
+//   - none: spans are created for propagation but not exported
+//
+// The returned function flushes pending spans and releases the exporter.
+func setupTracing(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	var err error
+	switch cfg.Tracing.Exporter {
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Tracing.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Tracing.Endpoint))
+		}
+		if cfg.Tracing.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		f, openErr := os.OpenFile(cfg.Tracing.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return nil, openErr
+		}
+		closeFile = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+		semconv.DeploymentEnvironmentName(cfg.Env),
+	)
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}, nil
+}
+
+// traceResponseHeader returns the request's trace context to the client as a
+// traceparent header, so a response can be matched to its trace
+func traceResponseHeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		otel.GetTextMapPropagator().Inject(c.Request.Context(), propagation.HeaderCarrier(c.Writer.Header()))
+		c.Next()
+	}
 }
@@ -15,84 +15,150 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/login": {
-            "post": {
-                "description": "Login with email and password, returns JWT",
-                "consumes": [
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Public keys for verifying access tokens, selected by the token's kid header",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/auth.JWKS"
+                        }
+                    }
+                }
+            }
+        },
+        "/audit": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List who changed which user or order, when and from where, newest first (admin only). Values of sensitive fields such as passwords are redacted in the changes.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "audit"
                 ],
-                "summary": "Login",
+                "summary": "List audit log entries",
                 "parameters": [
                     {
-                        "description": "Login credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.LoginRequest"
-                        }
+                        "enum": [
+                            "user",
+                            "order"
+                        ],
+                        "type": "string",
+                        "description": "Entity type",
+                        "name": "entity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Entity ID",
+                        "name": "entity_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the acting user, 0 for anonymous callers and background jobs",
+                        "name": "actor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, e.g. create, update, delete, change_role",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "At or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Before (RFC 3339), or on or before a YYYY-MM-DD date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 200)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handler.AuditListResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             }
         },
-        "/order/{id}": {
+        "/healthz": {
             "get": {
-                "description": "Get order data by ID",
-                "tags": [
-                    "order"
+                "description": "Reports that the process is running. It does not check dependencies.",
+                "produces": [
+                    "application/json"
                 ],
-                "summary": "Get order info",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Order ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                "tags": [
+                    "health"
                 ],
+                "summary": "Liveness probe",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Order"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
         },
-        "/register": {
+        "/login": {
             "post": {
-                "description": "Register a new user with name, email, and password",
+                "description": "Login with email and password, returns a short-lived JWT access token and a refresh token",
                 "consumes": [
                     "application/json"
                 ],
@@ -102,90 +168,82 @@ const docTemplate = `{
                 "tags": [
                     "user"
                 ],
-                "summary": "Register a new user",
+                "summary": "Login",
                 "parameters": [
                     {
-                        "description": "User Info",
-                        "name": "user",
+                        "description": "Login credentials",
+                        "name": "credentials",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.LoginRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.TokenResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid fields are listed in errors",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             }
         },
-        "/register_with_order": {
+        "/logout": {
             "post": {
-                "description": "Register a new user and create an order in a single transaction",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Revoke the current access token and every refresh token of its session",
                 "tags": [
                     "user"
                 ],
-                "summary": "Register a new user and create an order (transactional)",
-                "parameters": [
-                    {
-                        "description": "User and Order Info",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.RegisterUserWithOrderRequest"
-                        }
-                    }
-                ],
+                "summary": "Logout",
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "204": {
+                        "description": "No Content",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             }
         },
-        "/user": {
+        "/order": {
             "post": {
-                "description": "Add a new user",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create a new pending order. Its price is derived from the line items.",
                 "consumes": [
                     "application/json"
                 ],
@@ -193,17 +251,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "order"
                 ],
-                "summary": "Create new user",
+                "summary": "Create order",
                 "parameters": [
                     {
-                        "description": "User Info",
-                        "name": "user",
+                        "description": "Order Info",
+                        "name": "order",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.CreateOrderRequest"
                         }
                     }
                 ],
@@ -211,29 +269,46 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/model.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/{id}": {
+        "/order/{id}": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get user data by ID",
+                "description": "Get order data by ID. Orders of other users are reported as not found unless the caller may read every order.",
                 "tags": [
-                    "user"
+                    "order"
                 ],
-                "summary": "Get user info",
+                "summary": "Get order info",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Order ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -243,18 +318,30 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/model.Order"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             },
-            "put": {
+            "patch": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Edit user data by ID",
+                "description": "Change the product description or line items of a pending order",
                 "consumes": [
                     "application/json"
                 ],
@@ -262,24 +349,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "order"
                 ],
-                "summary": "Edit user",
+                "summary": "Update order",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Order ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "User Info",
-                        "name": "user",
+                        "description": "Fields to change",
+                        "name": "order",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.UpdateOrderRequest"
                         }
                     }
                 ],
@@ -287,57 +374,61 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/model.Order"
                         }
-                    }
-                }
-            },
-            "delete": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Delete user by ID",
-                "tags": [
-                    "user"
-                ],
-                "summary": "Delete user",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "204": {
-                        "description": "No Content",
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/{id}/orders": {
-            "get": {
+        "/order/{id}/cancel": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get user data and all orders by user ID",
+                "description": "Cancel an order that has not been fulfilled yet",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "user"
+                    "order"
                 ],
-                "summary": "Get user info with orders",
+                "summary": "Cancel order",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Order ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -347,26 +438,1072 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.UserWithOrders"
+                            "$ref": "#/definitions/model.Order"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
-                    }
-                }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{id}/history": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List every status change of an order with the acting user and time, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Get order status history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.OrderStatusHistory"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{id}/status": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Move an order along its lifecycle: pending → paid → fulfilled → shipped → delivered, or to cancelled (before fulfilment) / refunded (after payment). Illegal transitions return 409.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "Change order status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Order ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New status",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ChangeOrderStatusRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List orders newest first. Admins see all orders, other users only their own.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "order"
+                ],
+                "summary": "List orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by user ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339), or on or before a YYYY-MM-DD date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Order currency (ISO 4217)",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum total, in minor units",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum total, in minor units",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size (max 100)",
+                        "name": "page_size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.OrderListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Checks the database pools and Redis. Returns 503 if a required dependency is down; an unavailable cache only makes the service degraded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "description": "Register a new user with name, email, and password",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Register a new user",
+                "parameters": [
+                    {
+                        "description": "User Info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.RegisterUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/register_with_order": {
+            "post": {
+                "description": "Register a new user and create an order in a single transaction",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Register a new user and create an order (transactional)",
+                "parameters": [
+                    {
+                        "description": "User and Order Info",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.RegisterUserWithOrderRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.RegisterUserWithOrderResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new token pair. Each refresh token can be used once; reusing one revokes the whole session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Refresh access token",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.RefreshTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Add a new user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Create new user",
+                "parameters": [
+                    {
+                        "description": "User Info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get user data by ID",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user info",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace the name and email of a user. The password and role have their own endpoints.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Replace user profile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User Info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UpdateUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Soft delete a user and log out all of their sessions. The user can be restored until it is purged after the retention period. With the restrict orders policy, users who have orders can not be deleted (409 user_has_orders).",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Apply a JSON Merge Patch (RFC 7396) to a user. Only name and email can be changed; other members, or null, are rejected.",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Update user profile fields",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.PatchUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/orders": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get user data and all orders by user ID",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user info with orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserWithOrdersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/password": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace a user's password. The current password must be given, unless the caller may update other users (user:update) and resets another user's password. Every session of the user is revoked afterwards, so they have to log in again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Change password",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Current and new password",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ChangePasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors, a wrong current password is incorrect_password",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Undo the soft delete of a user that has not been purged yet (admin only)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Restore deleted user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No deleted user with this id",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "The email was registered again in the meantime",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/role": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Assign a policy role to a user (admin only). All of the user's sessions are logged out, so no token keeps the old role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Change user role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New role",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ChangeRoleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid fields are listed in errors",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List users with keyset pagination (admin only). Pass next_cursor from a response as cursor to get the next page, keeping the same sort and filters.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter by role",
+                        "name": "role",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by part of the email address, case-insensitive",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339), or on or before a YYYY-MM-DD date",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "include",
+                            "only"
+                        ],
+                        "type": "string",
+                        "description": "Soft-deleted users: include or only (default: left out)",
+                        "name": "deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "-created_at",
+                        "description": "id, created_at, name or email; prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size (max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also count all matching users",
+                        "name": "include_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
             }
         },
         "/userwithcache/{id}": {
             "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Retrieve a user by ID. Uses Redis cache if available; falls back to DB otherwise.",
                 "tags": [
                     "user"
@@ -385,78 +1522,416 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.UserResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
                     "403": {
                         "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/commonmodel.ErrorResponse"
+                            "$ref": "#/definitions/commonmodel.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "apperr.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "email"
+                },
+                "field": {
+                    "description": "JSON path of the field, e.g. items[0].price",
+                    "type": "string",
+                    "example": "email"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "must be a valid email address"
+                }
+            }
+        },
+        "auth.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string",
+                    "example": "EdDSA"
+                },
+                "crv": {
+                    "description": "Ed25519 curve and public key",
+                    "type": "string",
+                    "example": "Ed25519"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string",
+                    "example": "2025-01"
+                },
+                "kty": {
+                    "type": "string",
+                    "example": "OKP"
+                },
+                "n": {
+                    "description": "RSA modulus and exponent",
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string",
+                    "example": "sig"
+                },
+                "x": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.JWKS": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/auth.JWK"
+                    }
+                }
+            }
+        },
+        "commonmodel.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Stable, machine-readable error code",
+                    "type": "string",
+                    "example": "user_not_found"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "user not found"
+                },
+                "errors": {
+                    "description": "Every invalid request field, for validation errors",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/apperr.FieldError"
+                    }
+                },
+                "instance": {
+                    "description": "Request path the problem occurred on",
+                    "type": "string",
+                    "example": "/user/42"
+                },
+                "request_id": {
+                    "description": "Id of the request, also sent in the X-Request-ID header",
+                    "type": "string",
+                    "example": "4bf92f3577b34da6a3ce929d0e0e4736"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Not Found"
+                },
+                "type": {
+                    "description": "Always about:blank; the code extension identifies the problem",
+                    "type": "string",
+                    "example": "about:blank"
+                }
+            }
+        },
+        "handler.AuditListResponse": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Entry"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Pass as cursor to get the next page; absent on the last page",
+                    "type": "string",
+                    "example": "1234"
+                }
+            }
+        },
+        "handler.ChangeOrderStatusRequest": {
+            "type": "object",
+            "required": [
+                "status"
+            ],
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "paid",
+                        "fulfilled",
+                        "shipped",
+                        "delivered",
+                        "cancelled",
+                        "refunded"
+                    ],
+                    "example": "paid"
+                }
+            }
+        },
+        "handler.ChangePasswordRequest": {
+            "type": "object",
+            "required": [
+                "new_password"
+            ],
+            "properties": {
+                "new_password": {
+                    "description": "8 to 72 characters with at least one letter and one digit",
+                    "type": "string",
+                    "example": "n3wsecret"
+                },
+                "old_password": {
+                    "description": "Required unless an administrator resets another user's password",
+                    "type": "string",
+                    "example": "s3cretpass"
+                }
+            }
+        },
+        "handler.ChangeRoleRequest": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "description": "A role defined in the policy file",
+                    "type": "string",
+                    "example": "ops"
+                }
+            }
+        },
+        "handler.CreateOrderRequest": {
+            "type": "object",
+            "required": [
+                "items"
+            ],
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/handler.OrderItemRequest"
+                    }
+                },
+                "product": {
+                    "description": "Short description; defaults to the first item's name",
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Laptop"
+                },
+                "user_id": {
+                    "description": "Owner of the order; defaults to the caller. Only admins may create orders for other users.",
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 1
+                }
+            }
+        },
+        "handler.CreateUserRequest": {
+            "type": "object",
+            "required": [
+                "email",
+                "name",
+                "password",
+                "role"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "alice@example.com"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Alice"
+                },
+                "password": {
+                    "description": "8 to 72 characters with at least one letter and one digit",
+                    "type": "string",
+                    "example": "s3cretpass"
+                },
+                "role": {
+                    "description": "A role defined in the policy file",
+                    "type": "string",
+                    "example": "user"
+                }
+            }
+        },
+        "handler.LoginRequest": {
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "abc@gmail.com"
+                },
+                "password": {
+                    "type": "string",
+                    "example": "s3cretpass"
+                }
+            }
+        },
+        "handler.OrderItemRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Laptop"
+                },
+                "price": {
+                    "description": "Unit price in minor units of its currency, must be positive",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/money.Money"
                         }
-                    }
+                    ]
+                },
+                "product_id": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 42
+                },
+                "quantity": {
+                    "type": "integer",
+                    "maximum": 10000,
+                    "example": 1
                 }
             }
-        }
-    },
-    "definitions": {
-        "commonmodel.ErrorResponse": {
+        },
+        "handler.OrderListResponse": {
             "type": "object",
             "properties": {
-                "code": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Order"
+                    }
+                },
+                "page": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "page_size": {
                     "type": "integer",
-                    "example": 400
+                    "example": 20
                 },
-                "details": {
+                "total": {
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "handler.PatchUserRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
                     "type": "string",
-                    "example": "Invalid user id"
+                    "maxLength": 255,
+                    "example": "alice@example.com"
                 },
-                "error": {
+                "name": {
                     "type": "string",
-                    "example": "error message"
+                    "maxLength": 255,
+                    "minLength": 1,
+                    "example": "Alice"
                 }
             }
         },
-        "handler.LoginRequest": {
+        "handler.RefreshTokenRequest": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string",
+                    "example": "3q2-7wT1m0Qe..."
+                }
+            }
+        },
+        "handler.RegisterUserRequest": {
             "type": "object",
+            "required": [
+                "email",
+                "name",
+                "password"
+            ],
             "properties": {
                 "email": {
                     "type": "string",
-                    "example": "abc@gmail.com"
+                    "maxLength": 255,
+                    "example": "alice@example.com"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Alice"
                 },
                 "password": {
+                    "description": "8 to 72 characters with at least one letter and one digit",
                     "type": "string",
-                    "example": "1234"
+                    "example": "s3cretpass"
                 }
             }
         },
         "handler.RegisterUserWithOrderOrder": {
             "type": "object",
+            "required": [
+                "product"
+            ],
             "properties": {
                 "price": {
-                    "description": "Price\nexample: 100",
-                    "type": "integer"
+                    "description": "Price in minor units of its currency (e.g. cents), must be positive",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/money.Money"
+                        }
+                    ]
                 },
                 "product": {
                     "description": "Product\nexample: \"Laptop\"",
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 255
                 }
             }
         },
@@ -481,29 +1956,274 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.RegisterUserWithOrderResponse": {
+            "type": "object",
+            "properties": {
+                "order": {
+                    "$ref": "#/definitions/model.Order"
+                },
+                "user": {
+                    "$ref": "#/definitions/handler.UserResponse"
+                }
+            }
+        },
         "handler.RegisterUserWithOrderUser": {
             "type": "object",
+            "required": [
+                "email",
+                "name",
+                "password"
+            ],
             "properties": {
                 "email": {
                     "description": "User email\nexample: test@example.com",
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 255
                 },
                 "name": {
                     "description": "User name\nexample: testuser",
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 255
                 },
                 "password": {
-                    "description": "User password\nexample: 123456",
+                    "description": "User password, 8 to 72 characters with at least one letter and one digit\nexample: s3cretpass",
                     "type": "string"
                 }
             }
         },
-        "model.Order": {
+        "handler.TokenResponse": {
             "type": "object",
             "properties": {
-                "amount": {
-                    "type": "number"
+                "expires_in": {
+                    "description": "Access token lifetime in seconds",
+                    "type": "integer",
+                    "example": 900
+                },
+                "refresh_token": {
+                    "description": "Opaque refresh token, valid for a single use",
+                    "type": "string",
+                    "example": "3q2-7wT1m0Qe..."
+                },
+                "token": {
+                    "description": "Access token (JWT) to send as \"Authorization: Bearer \u003ctoken\u003e\"",
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "token_type": {
+                    "type": "string",
+                    "example": "Bearer"
+                }
+            }
+        },
+        "handler.UpdateOrderRequest": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/handler.OrderItemRequest"
+                    }
+                },
+                "product": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "minLength": 1,
+                    "example": "Laptop"
+                }
+            }
+        },
+        "handler.UpdateUserRequest": {
+            "type": "object",
+            "required": [
+                "email",
+                "name"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "alice@example.com"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Alice"
+                }
+            }
+        },
+        "handler.UserListResponse": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.UserResponse"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Pass as cursor to get the next page; absent on the last page",
+                    "type": "string",
+                    "example": "eyJzIjoiLWNyZWF0ZWRfYXQiLCJpZCI6NDJ9"
+                },
+                "total": {
+                    "description": "Only present when include_total=true",
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "handler.UserResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "Only set on soft-deleted users in admin listings",
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string",
+                    "example": "alice@example.com"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Alice"
+                },
+                "role": {
+                    "type": "string",
+                    "example": "user"
+                }
+            }
+        },
+        "handler.UserWithOrdersResponse": {
+            "type": "object",
+            "properties": {
+                "orders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Order"
+                    }
+                },
+                "user": {
+                    "$ref": "#/definitions/handler.UserResponse"
+                }
+            }
+        },
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/health.Result"
+                    }
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/health.Status"
+                        }
+                    ],
+                    "example": "ok"
+                }
+            }
+        },
+        "health.Result": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/health.Status"
+                        }
+                    ],
+                    "example": "ok"
+                }
+            }
+        },
+        "health.Status": {
+            "type": "string",
+            "enum": [
+                "ok",
+                "degraded",
+                "down"
+            ],
+            "x-enum-varnames": [
+                "StatusOK",
+                "StatusDegraded",
+                "StatusDown"
+            ]
+        },
+        "model.Change": {
+            "type": "object",
+            "properties": {
+                "from": {},
+                "to": {}
+            }
+        },
+        "model.Changes": {
+            "type": "object",
+            "additionalProperties": {
+                "$ref": "#/definitions/model.Change"
+            }
+        },
+        "model.Entry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "update"
                 },
+                "actorId": {
+                    "type": "integer"
+                },
+                "actorRole": {
+                    "type": "string"
+                },
+                "at": {
+                    "type": "string"
+                },
+                "changes": {
+                    "$ref": "#/definitions/model.Changes"
+                },
+                "entity": {
+                    "type": "string",
+                    "example": "user"
+                },
+                "entityId": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Order": {
+            "type": "object",
+            "properties": {
                 "created_at": {
                     "type": "string"
                 },
@@ -511,20 +2231,26 @@ const docTemplate = `{
                     "type": "integer"
                 },
                 "items": {
-                    "description": "Items is a slice of order items, ignored by GORM (not stored in DB)",
+                    "description": "Items are the order's line items, stored in the order_item table",
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/model.OrderItem"
                     }
                 },
                 "price": {
-                    "type": "number"
+                    "description": "Total of the line items",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/money.Money"
+                        }
+                    ]
                 },
                 "product": {
                     "type": "string"
                 },
                 "status": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "pending"
                 },
                 "user_id": {
                     "type": "integer"
@@ -534,11 +2260,22 @@ const docTemplate = `{
         "model.OrderItem": {
             "type": "object",
             "properties": {
+                "id": {
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
+                "order_id": {
+                    "type": "integer"
+                },
                 "price": {
-                    "type": "number"
+                    "description": "Unit price",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/money.Money"
+                        }
+                    ]
                 },
                 "product_id": {
                     "type": "integer"
@@ -548,40 +2285,44 @@ const docTemplate = `{
                 }
             }
         },
-        "model.User": {
+        "model.OrderStatusHistory": {
             "type": "object",
             "properties": {
-                "createdAt": {
-                    "type": "string"
+                "actor_id": {
+                    "type": "integer",
+                    "example": 1
                 },
-                "email": {
+                "changed_at": {
                     "type": "string"
                 },
+                "from_status": {
+                    "type": "string",
+                    "example": "pending"
+                },
                 "id": {
                     "type": "integer"
                 },
-                "name": {
-                    "type": "string"
-                },
-                "password": {
-                    "type": "string"
+                "order_id": {
+                    "type": "integer"
                 },
-                "role": {
-                    "type": "string"
+                "to_status": {
+                    "type": "string",
+                    "example": "paid"
                 }
             }
         },
-        "model.UserWithOrders": {
+        "money.Money": {
             "type": "object",
             "properties": {
-                "orders": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/model.Order"
-                    }
+                "amount": {
+                    "description": "Amount in minor units of the currency (e.g. cents for USD)",
+                    "type": "integer",
+                    "example": 1999
                 },
-                "user": {
-                    "$ref": "#/definitions/model.User"
+                "currency": {
+                    "description": "ISO 4217 currency code",
+                    "type": "string",
+                    "example": "USD"
                 }
             }
         }
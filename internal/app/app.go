@@ -0,0 +1,75 @@
+// Package app wires repositories, services and handlers together. Everything
+// is built once at startup and shared by all requests.
+package app
+
+import (
+	"log/slog"
+
+	audithandler "go-template/internal/audit/handler"
+	auditrepo "go-template/internal/audit/repository"
+	auditservice "go-template/internal/audit/service"
+	"go-template/internal/auth"
+	"go-template/internal/config"
+	"go-template/internal/db"
+	"go-template/internal/middleware"
+	orderhandler "go-template/internal/order/handler"
+	orderrepo "go-template/internal/order/repository"
+	orderservice "go-template/internal/order/service"
+	"go-template/internal/policy"
+	userhandler "go-template/internal/user/handler"
+	userrepo "go-template/internal/user/repository"
+	userservice "go-template/internal/user/service"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Deps are the connections and shared services the application is built on.
+// They are created in main and handed to every component that needs them.
+type Deps struct {
+	DB *gorm.DB
+	// Redis is nil when Redis is unavailable; the user cache is then disabled
+	Redis *redis.Client
+	// Tokens issues, verifies and revokes access and refresh tokens
+	Tokens *auth.Manager
+	// Policy grants permissions to roles
+	Policy *policy.Engine
+}
+
+// App holds the application's components
+type App struct {
+	TxManager db.TransactionManager
+	Guard     *middleware.Guard
+
+	UserRepo  userrepo.UserRepository
+	OrderRepo orderrepo.OrderRepository
+	AuditRepo auditrepo.AuditRepository
+
+	UserService  *userservice.UserService
+	OrderService *orderservice.OrderService
+	AuditService *auditservice.AuditService
+
+	UserHandler  *userhandler.UserHandler
+	OrderHandler *orderhandler.OrderHandler
+	AuditHandler *audithandler.AuditHandler
+}
+
+// New builds the application on deps. Every component logs through logger;
+// users sets the user deletion policy.
+func New(deps Deps, users config.UsersConfig, logger *slog.Logger) *App {
+	a := &App{
+		TxManager: db.NewTransactionManager(deps.DB, deps.Redis, logger),
+		Guard:     middleware.NewGuard(deps.Tokens, deps.Policy),
+		UserRepo:  userrepo.NewUserRepository(deps.DB, deps.Redis, logger),
+		OrderRepo: orderrepo.NewOrderRepository(deps.DB, logger),
+		AuditRepo: auditrepo.NewAuditRepository(deps.DB),
+	}
+	a.UserService = userservice.NewUserServiceWithTx(a.UserRepo, a.OrderRepo, a.TxManager, deps.Tokens, deps.Policy, logger).
+		WithOrdersOnDelete(users.OrdersOnDelete)
+	a.OrderService = orderservice.NewOrderServiceWithTx(a.OrderRepo, a.TxManager, logger)
+	a.AuditService = auditservice.NewAuditService(a.AuditRepo)
+	a.UserHandler = userhandler.NewUserHandler(a.UserService, a.Guard, logger)
+	a.OrderHandler = orderhandler.NewOrderHandler(a.OrderService, a.Guard, logger)
+	a.AuditHandler = audithandler.NewAuditHandler(a.AuditService, a.Guard)
+	return a
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-template/internal/audit/model"
+	"go-template/internal/common/apperr"
+	"go-template/internal/common/query"
+	"go-template/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditService is the audit log business logic the handlers depend on
+type AuditService interface {
+	ListEntries(ctx context.Context, filter model.Filter) (*model.Page, error)
+}
+
+var errInvalidQuery = apperr.Validation("invalid_query", "invalid query parameters")
+
+// AuditHandler serves the audit log. Failures are passed to the Errors
+// middleware with c.Error.
+type AuditHandler struct {
+	audit AuditService
+	guard *middleware.Guard
+}
+
+// NewAuditHandler creates the audit log handlers; guard protects their routes
+func NewAuditHandler(audit AuditService, guard *middleware.Guard) *AuditHandler {
+	return &AuditHandler{audit: audit, guard: guard}
+}
+
+// AuditListResponse is one page of audit entries, newest first
+type AuditListResponse struct {
+	Items []*model.Entry `json:"items"`
+	// Pass as cursor to get the next page; absent on the last page
+	NextCursor string `json:"next_cursor,omitempty" example:"1234"`
+}
+
+// ListEntries godoc
+// @Summary List audit log entries
+// @Description List who changed which user or order, when and from where, newest first (admin only). Values of sensitive fields such as passwords are redacted in the changes.
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Param entity query string false "Entity type" Enums(user, order)
+// @Param entity_id query int false "Entity ID"
+// @Param actor_id query int false "ID of the acting user, 0 for anonymous callers and background jobs"
+// @Param action query string false "Action, e.g. create, update, delete, change_role"
+// @Param from query string false "At or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Before (RFC 3339), or on or before a YYYY-MM-DD date"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size (max 200)" default(50)
+// @Success 200 {object} AuditListResponse
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /audit [get]
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.Error(errInvalidQuery.WithMessage("%s", err))
+		return
+	}
+	page, err := h.audit.ListEntries(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	resp := AuditListResponse{Items: page.Entries}
+	if resp.Items == nil {
+		resp.Items = []*model.Entry{}
+	}
+	if page.NextBeforeID != 0 {
+		resp.NextCursor = strconv.FormatInt(page.NextBeforeID, 10)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseAuditFilter reads the list filters from the query string
+func parseAuditFilter(c *gin.Context) (model.Filter, error) {
+	f := model.Filter{
+		Entity: c.Query("entity"),
+		Action: c.Query("action"),
+	}
+	var err error
+	if v := c.Query("entity_id"); v != "" {
+		if f.EntityID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("entity_id must be an integer")
+		}
+	}
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("actor_id must be an integer")
+		}
+		f.ActorID = &id
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := query.ParseFrom(v)
+		if err != nil {
+			return f, fmt.Errorf("from: %w", err)
+		}
+		f.From = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := query.ParseTo(v)
+		if err != nil {
+			return f, fmt.Errorf("to: %w", err)
+		}
+		f.To = &t
+	}
+	if v := c.Query("cursor"); v != "" {
+		if f.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil || f.BeforeID < 1 {
+			return f, fmt.Errorf("cursor is malformed")
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, fmt.Errorf("limit must be an integer")
+		}
+	}
+	return f, nil
+}
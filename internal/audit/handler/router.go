@@ -0,0 +1,7 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+func RegisterAuditRoutes(r *gin.Engine, h *AuditHandler) {
+	r.GET("/audit", h.guard.AuthMiddleware(), h.guard.RequirePermission("audit:read"), h.ListEntries)
+}
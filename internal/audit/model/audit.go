@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"go-template/internal/auth"
+	"go-template/internal/logging"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate         = "create"
+	ActionUpdate         = "update"
+	ActionDelete         = "delete"
+	ActionRestore        = "restore"
+	ActionPurge          = "purge"
+	ActionChangePassword = "change_password"
+	ActionChangeRole     = "change_role"
+	ActionChangeStatus   = "change_status"
+)
+
+// Entities whose changes are audited
+const (
+	EntityUser  = "user"
+	EntityOrder = "order"
+)
+
+// SystemRole is the actor role of changes made by background jobs
+const SystemRole = "system"
+
+// redacted replaces the values of sensitive fields in diffs
+const redacted = "[REDACTED]"
+
+// sensitiveFields never have their values written to the audit log
+var sensitiveFields = map[string]bool{
+	"password": true,
+}
+
+// TableName sets the table name for GORM to 'audit_log'
+func (Entry) TableName() string {
+	return "audit_log"
+}
+
+// Entry is one row of the append-only audit log: who changed what, when and
+// from where. ActorID is 0 for anonymous callers and background jobs.
+type Entry struct {
+	ID        int64     `json:"id"`
+	At        time.Time `json:"at" gorm:"column:at"`
+	ActorID   int64     `json:"actorId" gorm:"column:actorId"`
+	ActorRole string    `json:"actorRole" gorm:"column:actorRole"`
+	Action    string    `json:"action" example:"update"`
+	Entity    string    `json:"entity" example:"user"`
+	EntityID  int64     `json:"entityId" gorm:"column:entityId"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent" gorm:"column:userAgent"`
+	RequestID string    `json:"requestId" gorm:"column:requestId"`
+	Changes   Changes   `json:"changes" gorm:"type:jsonb"`
+}
+
+// Change is the value of one field before and after an operation.
+// From is null for created fields and To is null for removed ones.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Changes maps field names to their change; it is stored as JSON
+type Changes map[string]Change
+
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+	return errors.New("audit: unsupported changes value")
+}
+
+// Client is where a request came from
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying the request's client
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// NewEntry describes an operation on an entity. The actor, client and request
+// id are taken from ctx. before and after are snapshots of the entity (nil
+// when it did not exist before or does not exist after).
+func NewEntry(ctx context.Context, action, entity string, entityID int64, before, after map[string]any) *Entry {
+	e := &Entry{
+		At:        time.Now(),
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		RequestID: logging.RequestID(ctx),
+		Changes:   Diff(before, after),
+	}
+	if p, ok := auth.PrincipalFrom(ctx); ok {
+		e.ActorID = p.ID
+		e.ActorRole = p.Role
+	}
+	if client, ok := ctx.Value(clientKey{}).(Client); ok {
+		e.IP = client.IP
+		e.UserAgent = client.UserAgent
+	}
+	return e
+}
+
+// Snapshot returns the JSON fields of v, so fields hidden from the API (such
+// as password hashes) are left out of the audit log as well
+func Snapshot(v any) map[string]any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Diff returns the fields that differ between two snapshots. Values of
+// sensitive fields are redacted, so the log only shows that they changed.
+func Diff(before, after map[string]any) Changes {
+	changes := Changes{}
+	for k, from := range before {
+		if to, ok := after[k]; !ok || !reflect.DeepEqual(from, to) {
+			changes[k] = Change{From: from, To: after[k]}
+		}
+	}
+	for k, to := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = Change{To: to}
+		}
+	}
+	for k, c := range changes {
+		if sensitiveFields[k] {
+			changes[k] = redact(c)
+		}
+	}
+	return changes
+}
+
+func redact(c Change) Change {
+	if c.From != nil {
+		c.From = redacted
+	}
+	if c.To != nil {
+		c.To = redacted
+	}
+	return c
+}
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// Filter selects audit entries for listing, newest first. Zero values mean "no filter".
+type Filter struct {
+	Entity   string
+	EntityID int64
+	ActorID  *int64
+	Action   string
+	// From is inclusive, To is exclusive
+	From *time.Time
+	To   *time.Time
+	// BeforeID is the cursor: only entries with a smaller id are returned
+	BeforeID int64
+	Limit    int
+}
+
+// Normalize clamps the page size
+func (f *Filter) Normalize() {
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+}
+
+// Page is one page of audit entries
+type Page struct {
+	Entries []*Entry
+	// NextBeforeID is the cursor of the following page, 0 on the last page
+	NextBeforeID int64
+}
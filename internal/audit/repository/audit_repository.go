@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"go-template/internal/audit/model"
+
+	"gorm.io/gorm"
+)
+
+// AuditRepository appends to and reads the audit log. There is deliberately
+// no way to change or remove entries; the table rejects it as well.
+type AuditRepository interface {
+	// Record appends an entry. Call it on the unit of work of the audited
+	// change so both are committed or rolled back together.
+	Record(ctx context.Context, entry *model.Entry) error
+	// ListEntries returns up to filter.Limit entries matching the filter, newest first
+	ListEntries(ctx context.Context, filter model.Filter) ([]*model.Entry, error)
+}
+
+// GormAuditRepository implements AuditRepository using GORM
+type GormAuditRepository struct {
+	DB *gorm.DB
+}
+
+// NewAuditRepository returns an AuditRepository implemented with GORM
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &GormAuditRepository{DB: db}
+}
+
+func (r *GormAuditRepository) Record(ctx context.Context, entry *model.Entry) error {
+	return r.DB.WithContext(ctx).Create(entry).Error
+}
+
+func (r *GormAuditRepository) ListEntries(ctx context.Context, filter model.Filter) ([]*model.Entry, error) {
+	q := r.DB.WithContext(ctx).Model(&model.Entry{})
+	if filter.Entity != "" {
+		q = q.Where(`"entity" = ?`, filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		q = q.Where(`"entityId" = ?`, filter.EntityID)
+	}
+	if filter.ActorID != nil {
+		q = q.Where(`"actorId" = ?`, *filter.ActorID)
+	}
+	if filter.Action != "" {
+		q = q.Where(`"action" = ?`, filter.Action)
+	}
+	if filter.From != nil {
+		q = q.Where(`"at" >= ?`, *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where(`"at" < ?`, *filter.To)
+	}
+	if filter.BeforeID != 0 {
+		q = q.Where(`"id" < ?`, filter.BeforeID)
+	}
+	var entries []*model.Entry
+	result := q.Order(`"id" DESC`).Limit(filter.Limit).Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"go-template/internal/audit/model"
+	"go-template/internal/audit/repository"
+	"go-template/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("go-template/internal/audit/service")
+
+// AuditService reads the audit log. Entries are written by the other services
+// on their own unit of work, see repository.AuditRepository.Record.
+type AuditService struct {
+	Repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) *AuditService {
+	return &AuditService{Repo: repo}
+}
+
+// ListEntries returns one page of entries matching the filter, newest first
+func (s *AuditService) ListEntries(ctx context.Context, filter model.Filter) (_ *model.Page, err error) {
+	ctx, span := tracer.Start(ctx, "AuditService.ListEntries")
+	defer func() { tracing.End(span, err) }()
+	filter.Normalize()
+	// Fetch one extra entry to learn whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := s.Repo.ListEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.Page{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextBeforeID = page.Entries[limit-1].ID
+	}
+	return page, nil
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a verification key, optionally with the private half used for signing
+type Key struct {
+	KID     string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	Private crypto.Signer // nil for verify-only keys
+}
+
+// Keyring holds every key that tokens may be verified with and the single key
+// new tokens are signed with. A legacy HS256 secret can be kept for verification
+// only, so tokens issued before the switch to asymmetric keys stay valid.
+type Keyring struct {
+	keys       map[string]*Key
+	signing    *Key
+	hmacSecret []byte
+	hmacUntil  time.Time // end of the HS256 migration window
+}
+
+// NewKeyring creates a Keyring that signs with the key identified by signingKID
+func NewKeyring(signingKID string, keys ...*Key) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*Key)}
+	for _, key := range keys {
+		if _, dup := k.keys[key.KID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", key.KID)
+		}
+		k.keys[key.KID] = key
+	}
+	signing, ok := k.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingKID)
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+	}
+	k.signing = signing
+	return k, nil
+}
+
+// AcceptHS256 keeps accepting HS256 tokens signed with secret until the given
+// time. New tokens are never signed with it.
+func (k *Keyring) AcceptHS256(secret []byte, until time.Time) {
+	k.hmacSecret = secret
+	k.hmacUntil = until
+}
+
+// LoadKeyring reads every *.pem file in dir; the file name without extension is
+// the key id. Private keys can sign and verify, public keys only verify (e.g.
+// keys being retired). If signingKID is empty and exactly one private key is
+// present, that key is used for signing.
+func LoadKeyring(dir, signingKID string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var keys []*Key
+	var privateKIDs []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if key.Private != nil {
+			privateKIDs = append(privateKIDs, kid)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s, generate one as described in configs/keys/README.md", dir)
+	}
+	if signingKID == "" {
+		if len(privateKIDs) != 1 {
+			return nil, fmt.Errorf("found %d private keys in %s, set the signing key id explicitly", len(privateKIDs), dir)
+		}
+		signingKID = privateKIDs[0]
+	}
+	return NewKeyring(signingKID, keys...)
+}
+
+// ParseKeyPEM parses an RSA or Ed25519 key in PEM form (PKCS#1, PKCS#8 or PKIX)
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{KID: kid, Method: jwt.SigningMethodRS256, Public: &k.PublicKey, Private: k}, nil
+	case *rsa.PublicKey:
+		return &Key{KID: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{KID: kid, Method: jwt.SigningMethodEdDSA, Public: k.Public(), Private: k}, nil
+	case ed25519.PublicKey:
+		return &Key{KID: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// GenerateEd25519Key creates a new in-memory signing key
+func GenerateEd25519Key(kid string) (*Key, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{KID: kid, Method: jwt.SigningMethodEdDSA, Public: pub, Private: priv}, nil
+}
+
+// sign signs claims with the current signing key and sets the kid header
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.KID
+	return token.SignedString(k.signing.Private)
+}
+
+// validMethods lists the algorithms accepted when verifying
+func (k *Keyring) validMethods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range k.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	if k.hmacAccepted() {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+func (k *Keyring) hmacAccepted() bool {
+	return len(k.hmacSecret) > 0 && time.Now().Before(k.hmacUntil)
+}
+
+// keyFunc selects the verification key by the token's kid header
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if !k.hmacAccepted() {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return k.hmacSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s does not match key %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty" example:"OKP"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"EdDSA"`
+	Kid string `json:"kid" example:"2025-01"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Crv string `json:"crv,omitempty" example:"Ed25519"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the ring, sorted by kid
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.KID}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateRSAKey(t *testing.T, kid string) *Key {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Key{KID: kid, Method: jwt.SigningMethodRS256, Public: &priv.PublicKey, Private: priv}
+}
+
+func generateEd25519(t *testing.T, kid string) *Key {
+	t.Helper()
+	key, err := GenerateEd25519Key(kid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signWith signs claims the way another issuer would, with any key, kid and method
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func verify(k *Keyring, token string) error {
+	_, err := jwt.ParseWithClaims(token, &Claims{}, k.keyFunc, jwt.WithValidMethods(k.validMethods()))
+	return err
+}
+
+func TestKeyringSignsWithSigningKeyAndVerifiesByKid(t *testing.T) {
+	old := generateRSAKey(t, "2025-01")
+	current := generateEd25519(t, "2025-06")
+	// The retired key is kept for verification only
+	retired := &Key{KID: old.KID, Method: old.Method, Public: old.Public}
+	k, err := NewKeyring(current.KID, retired, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := k.sign(Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != current.KID || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("signed with kid %v alg %s, want %s EdDSA", parsed.Header["kid"], parsed.Method.Alg(), current.KID)
+	}
+	if err := verify(k, signed); err != nil {
+		t.Errorf("token signed by the ring: %v", err)
+	}
+	if err := verify(k, signWith(t, jwt.SigningMethodRS256, old.KID, old.Private)); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+}
+
+func TestKeyringRejectsUnknownKidAndWrongAlgorithm(t *testing.T) {
+	rsaKey := generateRSAKey(t, "rsa")
+	edKey := generateEd25519(t, "ed")
+	k, err := NewKeyring(edKey.KID, rsaKey, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger := generateEd25519(t, "stranger")
+	tests := map[string]string{
+		"unknown kid":                   signWith(t, jwt.SigningMethodEdDSA, "stranger", stranger.Private),
+		"missing kid":                   signWith(t, jwt.SigningMethodEdDSA, "", edKey.Private),
+		"known kid, foreign key":        signWith(t, jwt.SigningMethodEdDSA, "ed", stranger.Private),
+		"EdDSA token for an RSA kid":    signWith(t, jwt.SigningMethodEdDSA, "rsa", edKey.Private),
+		"RS256 token for an EdDSA kid":  signWith(t, jwt.SigningMethodRS256, "ed", rsaKey.Private),
+		"HS256 without a legacy secret": signWith(t, jwt.SigningMethodHS256, "", []byte("secret")),
+		"alg none":                      signWith(t, jwt.SigningMethodNone, "ed", jwt.UnsafeAllowNoneSignatureType),
+	}
+	for name, token := range tests {
+		if err := verify(k, token); err == nil {
+			t.Errorf("%s: token was accepted", name)
+		}
+	}
+}
+
+func TestKeyringHS256MigrationWindow(t *testing.T) {
+	secret := []byte("legacy-secret")
+	legacy := signWith(t, jwt.SigningMethodHS256, "", secret)
+	tests := []struct {
+		name   string
+		until  time.Time
+		accept bool
+	}{
+		{"before the cutoff", time.Now().Add(time.Hour), true},
+		{"after the cutoff", time.Now().Add(-time.Second), false},
+		{"no cutoff", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := generateEd25519(t, "ed")
+			k, err := NewKeyring(key.KID, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k.AcceptHS256(secret, tt.until)
+			if err := verify(k, legacy); (err == nil) != tt.accept {
+				t.Errorf("accepted = %v, want %v (err %v)", err == nil, tt.accept, err)
+			}
+		})
+	}
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	rsaKey := generateRSAKey(t, "b-rsa")
+	edKey := generateEd25519(t, "a-ed")
+	k, err := NewKeyring(edKey.KID, rsaKey, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := k.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "a-ed" || set.Keys[1].Kid != "b-rsa" {
+		t.Fatalf("JWKS keys = %+v, want a-ed then b-rsa", set.Keys)
+	}
+	ed, rs := set.Keys[0], set.Keys[1]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" || ed.X == "" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if rs.Kty != "RSA" || rs.Alg != "RS256" || rs.N == "" || rs.E != "AQAB" {
+		t.Errorf("RSA JWK = %+v", rs)
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, jwk := range raw.Keys {
+		for _, private := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := jwk[private]; ok {
+				t.Errorf("JWK %v publishes private member %q", jwk["kid"], private)
+			}
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	signing := generateEd25519(t, "2025-06")
+	retired := generateRSAKey(t, "2025-01")
+	privDER, err := x509.MarshalPKCS8PrivateKey(signing.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(retired.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM := func(name, blockType string, der []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePEM("2025-06.pem", "PRIVATE KEY", privDER)
+	writePEM("2025-01.pem", "PUBLIC KEY", pubDER)
+
+	// The only private key is picked as the signing key
+	k, err := LoadKeyring(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.signing.KID != "2025-06" {
+		t.Errorf("signing kid = %q, want 2025-06", k.signing.KID)
+	}
+	if len(k.JWKS().Keys) != 2 {
+		t.Errorf("loaded %d keys, want 2", len(k.JWKS().Keys))
+	}
+	if _, err := LoadKeyring(dir, "2025-01"); err == nil {
+		t.Error("a public key was accepted as the signing key")
+	}
+	if _, err := LoadKeyring(t.TempDir(), ""); err == nil || !strings.Contains(err.Error(), "README") {
+		t.Errorf("empty keys dir: err = %v, want a pointer to the README", err)
+	}
+}
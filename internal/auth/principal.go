@@ -0,0 +1,35 @@
+package auth
+
+import "context"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID    int64
+	Name  string
+	Email string
+	Role  string
+}
+
+// Principal returns the caller identified by an access token
+func (c *Claims) Principal() *Principal {
+	return &Principal{
+		ID:    int64(c.UserID),
+		Name:  c.Name,
+		Email: c.Email,
+		Role:  c.Role,
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated caller, so
+// code below the handlers (e.g. the audit log) can tell who is acting
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller stored by WithPrincipal
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
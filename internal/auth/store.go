@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RevocationList keeps the ids (jti) of access tokens revoked before they expire
+type RevocationList interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RefreshToken is the stored record of an issued refresh token
+type RefreshToken struct {
+	Hash      string    `json:"-"`
+	UserID    int       `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RefreshTokenStore keeps refresh tokens and revoked sessions
+type RefreshTokenStore interface {
+	// Save stores a newly issued refresh token
+	Save(ctx context.Context, token *RefreshToken) error
+	// Get returns a refresh token by hash. Returns nil if not found.
+	Get(ctx context.Context, hash string) (*RefreshToken, error)
+	// MarkUsed marks a refresh token as used and reports whether this was its first use
+	MarkUsed(ctx context.Context, hash string, ttl time.Duration) (bool, error)
+	// RevokeSession revokes every token issued for a session
+	RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	// RevokeUserSessions revokes every session a refresh token was saved for the user
+	RevokeUserSessions(ctx context.Context, userID int, ttl time.Duration) error
+}
+
+// RedisRevocationList implements RevocationList using Redis keys that expire with the token
+type RedisRevocationList struct {
+	Rdb *redis.Client
+}
+
+func NewRedisRevocationList(rdb *redis.Client) RevocationList {
+	return &RedisRevocationList{Rdb: rdb}
+}
+
+func (l *RedisRevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return l.Rdb.Set(ctx, "auth:revoked:"+jti, 1, ttl).Err()
+}
+
+func (l *RedisRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := l.Rdb.Exists(ctx, "auth:revoked:"+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RedisRefreshTokenStore implements RefreshTokenStore using Redis
+type RedisRefreshTokenStore struct {
+	Rdb *redis.Client
+}
+
+func NewRedisRefreshTokenStore(rdb *redis.Client) RefreshTokenStore {
+	return &RedisRefreshTokenStore{Rdb: rdb}
+}
+
+func (s *RedisRefreshTokenStore) Save(ctx context.Context, token *RefreshToken) error {
+	bytes, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(token.ExpiresAt)
+	// The per-user set of sessions lives as long as the newest refresh token
+	sessions := userSessionsKey(token.UserID)
+	_, err = s.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "auth:refresh:"+token.Hash, bytes, ttl)
+		pipe.SAdd(ctx, sessions, token.SessionID)
+		pipe.Expire(ctx, sessions, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisRefreshTokenStore) Get(ctx context.Context, hash string) (*RefreshToken, error) {
+	val, err := s.Rdb.Get(ctx, "auth:refresh:"+hash).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token RefreshToken
+	if err := json.Unmarshal([]byte(val), &token); err != nil {
+		return nil, fmt.Errorf("corrupt refresh token record: %w", err)
+	}
+	token.Hash = hash
+	return &token, nil
+}
+
+func (s *RedisRefreshTokenStore) MarkUsed(ctx context.Context, hash string, ttl time.Duration) (bool, error) {
+	// SETNX makes the first-use check atomic across instances
+	return s.Rdb.SetNX(ctx, "auth:refresh_used:"+hash, 1, ttl).Result()
+}
+
+func (s *RedisRefreshTokenStore) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return s.Rdb.Set(ctx, "auth:session_revoked:"+sessionID, 1, ttl).Err()
+}
+
+func (s *RedisRefreshTokenStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := s.Rdb.Exists(ctx, "auth:session_revoked:"+sessionID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *RedisRefreshTokenStore) RevokeUserSessions(ctx context.Context, userID int, ttl time.Duration) error {
+	key := userSessionsKey(userID)
+	sessionIDs, err := s.Rdb.SMembers(ctx, key).Result()
+	if err != nil || len(sessionIDs) == 0 {
+		return err
+	}
+	_, err = s.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range sessionIDs {
+			pipe.Set(ctx, "auth:session_revoked:"+id, 1, ttl)
+		}
+		pipe.SRem(ctx, key, toAny(sessionIDs)...)
+		return nil
+	})
+	return err
+}
+
+func userSessionsKey(userID int) string {
+	return "auth:user_sessions:" + strconv.Itoa(userID)
+}
+
+func toAny(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+// minSweepSize is the size below which expired entries are not swept
+const minSweepSize = 64
+
+// sweepSchedule amortizes removing expired entries from a map: it is swept
+// once it has doubled in size since the last sweep, so every insert costs
+// O(1) on average instead of a scan of the whole map
+type sweepSchedule struct {
+	next int
+}
+
+func (s *sweepSchedule) due(size int) bool {
+	return size >= s.next
+}
+
+func (s *sweepSchedule) swept(size int) {
+	s.next = max(2*size, minSweepSize)
+}
+
+// expiringSet is a concurrency-safe set whose entries expire
+type expiringSet struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	sweep   sweepSchedule
+}
+
+func newExpiringSet() *expiringSet {
+	return &expiringSet{entries: make(map[string]time.Time)}
+}
+
+// add inserts key and reports whether it was not already present
+func (s *expiringSet) add(key string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.sweep.due(len(s.entries)) {
+		for k, exp := range s.entries {
+			if now.After(exp) {
+				delete(s.entries, k)
+			}
+		}
+		s.sweep.swept(len(s.entries))
+	}
+	if exp, ok := s.entries[key]; ok && !now.After(exp) {
+		return false
+	}
+	s.entries[key] = expiresAt
+	return true
+}
+
+func (s *expiringSet) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.entries[key]
+	return ok && time.Now().Before(exp)
+}
+
+// MemoryRevocationList implements RevocationList in process memory.
+// It is only suitable for a single instance and is lost on restart.
+type MemoryRevocationList struct {
+	revoked *expiringSet
+}
+
+func NewMemoryRevocationList() RevocationList {
+	return &MemoryRevocationList{revoked: newExpiringSet()}
+}
+
+func (l *MemoryRevocationList) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	l.revoked.add(jti, expiresAt)
+	return nil
+}
+
+func (l *MemoryRevocationList) IsRevoked(_ context.Context, jti string) (bool, error) {
+	return l.revoked.has(jti), nil
+}
+
+// MemoryRefreshTokenStore implements RefreshTokenStore in process memory
+type MemoryRefreshTokenStore struct {
+	mu       sync.Mutex
+	tokens   map[string]RefreshToken
+	used     *expiringSet
+	sessions *expiringSet
+	// userSessions holds the sessions of each user, with the expiry of their newest refresh token
+	userSessions map[int]map[string]time.Time
+	sweep        sweepSchedule
+}
+
+func NewMemoryRefreshTokenStore() RefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens:       make(map[string]RefreshToken),
+		used:         newExpiringSet(),
+		sessions:     newExpiringSet(),
+		userSessions: make(map[int]map[string]time.Time),
+	}
+}
+
+func (s *MemoryRefreshTokenStore) Save(_ context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sweep.due(len(s.tokens)) {
+		s.removeExpired(time.Now())
+	}
+	s.tokens[token.Hash] = *token
+	if s.userSessions[token.UserID] == nil {
+		s.userSessions[token.UserID] = make(map[string]time.Time)
+	}
+	s.userSessions[token.UserID][token.SessionID] = token.ExpiresAt
+	return nil
+}
+
+// removeExpired drops expired tokens and sessions; s.mu must be held
+func (s *MemoryRefreshTokenStore) removeExpired(now time.Time) {
+	for k, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, k)
+		}
+	}
+	for userID, sessions := range s.userSessions {
+		for id, exp := range sessions {
+			if now.After(exp) {
+				delete(sessions, id)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.userSessions, userID)
+		}
+	}
+	s.sweep.swept(len(s.tokens))
+}
+
+func (s *MemoryRefreshTokenStore) Get(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *MemoryRefreshTokenStore) MarkUsed(_ context.Context, hash string, ttl time.Duration) (bool, error) {
+	return s.used.add(hash, time.Now().Add(ttl)), nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeSession(_ context.Context, sessionID string, ttl time.Duration) error {
+	s.sessions.add(sessionID, time.Now().Add(ttl))
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) IsSessionRevoked(_ context.Context, sessionID string) (bool, error) {
+	return s.sessions.has(sessionID), nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeUserSessions(_ context.Context, userID int, ttl time.Duration) error {
+	s.mu.Lock()
+	sessions := s.userSessions[userID]
+	delete(s.userSessions, userID)
+	s.mu.Unlock()
+	for id := range sessions {
+		s.sessions.add(id, time.Now().Add(ttl))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpiringSet(t *testing.T) {
+	s := newExpiringSet()
+	future := time.Now().Add(time.Hour)
+	if !s.add("a", future) {
+		t.Fatal("first add of a reported a duplicate")
+	}
+	if s.add("a", future) {
+		t.Error("second add of a was not reported as a duplicate")
+	}
+	if !s.has("a") {
+		t.Error("has(a) = false")
+	}
+	s.add("old", time.Now().Add(-time.Second))
+	if s.has("old") {
+		t.Error("expired entry is still present")
+	}
+	if !s.add("old", future) {
+		t.Error("an expired entry could not be added again")
+	}
+}
+
+func TestExpiringSetSweepsExpiredEntries(t *testing.T) {
+	s := newExpiringSet()
+	past := time.Now().Add(-time.Second)
+	for i := 0; i < 10*minSweepSize; i++ {
+		s.add(fmt.Sprint("expired-", i), past)
+	}
+	s.add("live", time.Now().Add(time.Hour))
+	// Sweeps only run once the set has doubled, so it never holds more than
+	// about twice minSweepSize entries when all others have expired
+	if n := len(s.entries); n > 2*minSweepSize {
+		t.Errorf("set holds %d entries, expired ones are not swept", n)
+	}
+	if !s.has("live") {
+		t.Error("live entry was swept")
+	}
+}
+
+func TestMemoryRefreshTokenStoreSweepsExpiredTokens(t *testing.T) {
+	s := NewMemoryRefreshTokenStore().(*MemoryRefreshTokenStore)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Second)
+	for i := 0; i < 10*minSweepSize; i++ {
+		s.Save(ctx, &RefreshToken{Hash: fmt.Sprint("h", i), UserID: i, SessionID: fmt.Sprint("s", i), ExpiresAt: past})
+	}
+	if n := len(s.tokens); n > 2*minSweepSize {
+		t.Errorf("store holds %d tokens, expired ones are not swept", n)
+	}
+	if n := len(s.userSessions); n > 2*minSweepSize {
+		t.Errorf("store tracks sessions of %d users, expired ones are not swept", n)
+	}
+}
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go-template/internal/common/apperr"
+	"go-template/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// AccessTokenTTL is the default lifetime of an access token.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the default lifetime of a refresh token (and its session).
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken       = apperr.Unauthorized("invalid_token", "invalid token")
+	ErrTokenRevoked       = apperr.Unauthorized("token_revoked", "token has been revoked")
+	ErrRefreshTokenReused = apperr.Unauthorized("refresh_token_reused", "refresh token reuse detected")
+)
+
+// Subject is the identity a token pair is issued for
+type Subject struct {
+	ID    int
+	Name  string
+	Email string
+	Role  string
+}
+
+// Claims are the JWT claims carried by an access token.
+// RegisteredClaims.ID is the token id (jti), SessionID groups all tokens
+// issued from the same login so they can be revoked together.
+type Claims struct {
+	UserID    int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is a short-lived access token plus the refresh token used to renew it
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// Manager issues, verifies, rotates and revokes tokens
+type Manager struct {
+	keys          *Keyring
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	revocations   RevocationList
+	refreshTokens RefreshTokenStore
+}
+
+// NewManager creates a Manager signing and verifying tokens with the given keyring
+func NewManager(keys *Keyring, revocations RevocationList, refreshTokens RefreshTokenStore) *Manager {
+	return &Manager{
+		keys:          keys,
+		accessTTL:     AccessTokenTTL,
+		refreshTTL:    RefreshTokenTTL,
+		revocations:   revocations,
+		refreshTokens: refreshTokens,
+	}
+}
+
+// WithTTL overrides how long access and refresh tokens stay valid
+func (m *Manager) WithTTL(access, refresh time.Duration) *Manager {
+	m.accessTTL = access
+	m.refreshTTL = refresh
+	return m
+}
+
+// NewManagerFromConfig builds the Manager for cfg. Revocation state is kept in
+// rdb, or in process memory when rdb is nil (Redis unavailable).
+//
+// Signing keys are read from cfg.KeysDir (one PEM file per kid) and
+// cfg.SigningKID selects the signing key. cfg.LegacySecret, if set, is still
+// accepted for HS256 tokens until cfg.HS256AcceptUntil. Without a cutoff HS256
+// tokens are rejected.
+func NewManagerFromConfig(cfg config.AuthConfig, rdb *redis.Client) (*Manager, error) {
+	keys, err := loadKeyring(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+	if rdb != nil {
+		return NewManager(keys, NewRedisRevocationList(rdb), NewRedisRefreshTokenStore(rdb)).
+			WithTTL(cfg.AccessTokenTTL, cfg.RefreshTokenTTL), nil
+	}
+	slog.Warn("Token revocation list is kept in memory (Redis unavailable)")
+	return NewManager(keys, NewMemoryRevocationList(), NewMemoryRefreshTokenStore()).
+		WithTTL(cfg.AccessTokenTTL, cfg.RefreshTokenTTL), nil
+}
+
+func loadKeyring(cfg config.AuthConfig) (*Keyring, error) {
+	var keys *Keyring
+	if cfg.KeysDir != "" {
+		var err error
+		keys, err = LoadKeyring(cfg.KeysDir, cfg.SigningKID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Without configured keys, tokens only survive until restart and are
+		// not verifiable by other instances.
+		slog.Warn("auth.keys_dir not set, using an ephemeral Ed25519 signing key")
+		key, err := GenerateEd25519Key("ephemeral")
+		if err != nil {
+			return nil, err
+		}
+		keys, err = NewKeyring(key.KID, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LegacySecret != "" {
+		if cfg.HS256AcceptUntil.IsZero() {
+			slog.Warn("auth.hs256_accept_until not set, legacy HS256 tokens are rejected")
+		} else {
+			keys.AcceptHS256([]byte(cfg.LegacySecret), cfg.HS256AcceptUntil)
+		}
+	}
+	return keys, nil
+}
+
+// JWKS returns the public keys tokens can be verified with
+func (m *Manager) JWKS() JWKS {
+	return m.keys.JWKS()
+}
+
+// IssueTokens starts a new session for the subject and returns its first token pair
+func (m *Manager) IssueTokens(ctx context.Context, sub Subject) (*TokenPair, error) {
+	sessionID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	return m.issue(ctx, sub, sessionID)
+}
+
+// IssueTokensForSession returns a new token pair within an existing session
+func (m *Manager) IssueTokensForSession(ctx context.Context, sub Subject, sessionID string) (*TokenPair, error) {
+	return m.issue(ctx, sub, sessionID)
+}
+
+func (m *Manager) issue(ctx context.Context, sub Subject, sessionID string) (*TokenPair, error) {
+	now := time.Now()
+	jti, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	accessExp := now.Add(m.accessTTL)
+	accessToken, err := m.keys.sign(Claims{
+		UserID:    sub.ID,
+		Name:      sub.Name,
+		Email:     sub.Email,
+		Role:      sub.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(accessExp),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	rawRefresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshExp := now.Add(m.refreshTTL)
+	if err := m.refreshTokens.Save(ctx, &RefreshToken{
+		Hash:      hashToken(rawRefresh),
+		UserID:    sub.ID,
+		SessionID: sessionID,
+		ExpiresAt: refreshExp,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExp,
+		RefreshToken:          rawRefresh,
+		RefreshTokenExpiresAt: refreshExp,
+	}, nil
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token and
+// checks that neither the token nor its session has been revoked.
+func (m *Manager) ParseAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keys.keyFunc, jwt.WithValidMethods(m.keys.validMethods()))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.ID != "" {
+		revoked, err := m.revocations.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	if claims.SessionID != "" {
+		revoked, err := m.refreshTokens.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// ConsumeRefreshToken validates a refresh token and marks it as used so it can
+// not be presented again. Presenting an already used token is treated as theft:
+// the whole session is revoked and ErrRefreshTokenReused is returned.
+func (m *Manager) ConsumeRefreshToken(ctx context.Context, raw string) (*RefreshToken, error) {
+	hash := hashToken(raw)
+	rec, err := m.refreshTokens.Get(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load refresh token: %w", err)
+	}
+	if rec == nil || time.Now().After(rec.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	revoked, err := m.refreshTokens.IsSessionRevoked(ctx, rec.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	firstUse, err := m.refreshTokens.MarkUsed(ctx, hash, time.Until(rec.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	if !firstUse {
+		// Revoke even if the client has gone away, the token may be stolen
+		if err := m.refreshTokens.RevokeSession(context.WithoutCancel(ctx), rec.SessionID, m.refreshTTL); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return rec, nil
+}
+
+// Revoke invalidates the given access token and every token of its session
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := m.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+	}
+	if claims.SessionID != "" {
+		if err := m.refreshTokens.RevokeSession(ctx, claims.SessionID, m.refreshTTL); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+	return nil
+}
+
+// RevokeUserSessions invalidates every session of the user, e.g. after their
+// password changed. Access tokens of those sessions are rejected as well.
+func (m *Manager) RevokeUserSessions(ctx context.Context, userID int) error {
+	if err := m.refreshTokens.RevokeUserSessions(ctx, userID, m.refreshTTL); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// randomID returns a random hex identifier used for jti and session ids
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomToken returns an opaque, URL-safe refresh token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is used so raw refresh tokens are never stored
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	key, err := GenerateEd25519Key("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(key.KID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(keys, NewMemoryRevocationList(), NewMemoryRefreshTokenStore())
+}
+
+var alice = Subject{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "user"}
+
+func TestIssueAndParseAccessToken(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	pair, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.ParseAccessToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	if claims.UserID != alice.ID || claims.Role != alice.Role || claims.SessionID == "" || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if _, err := m.ParseAccessToken(ctx, pair.AccessToken+"x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("tampered token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	first, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := m.ConsumeRefreshToken(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if rec.UserID != alice.ID {
+		t.Errorf("refresh token user = %d, want %d", rec.UserID, alice.ID)
+	}
+	second, err := m.IssueTokensForSession(ctx, alice, rec.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("rotation returned the same refresh token")
+	}
+	rec2, err := m.ConsumeRefreshToken(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("rotated token: %v", err)
+	}
+	if rec2.SessionID != rec.SessionID {
+		t.Errorf("rotated token left the session: %q, want %q", rec2.SessionID, rec.SessionID)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	first, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := m.ConsumeRefreshToken(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.IssueTokensForSession(ctx, alice, rec.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.ConsumeRefreshToken(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	// Every token of the session is revoked, including the ones issued after the stolen one
+	if _, err := m.ConsumeRefreshToken(ctx, second.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh token of the session: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := m.ParseAccessToken(ctx, second.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token of the session: err = %v, want ErrTokenRevoked", err)
+	}
+	// Other sessions of the user are left alone
+	if _, err := m.ParseAccessToken(ctx, other.AccessToken); err != nil {
+		t.Errorf("access token of another session: %v", err)
+	}
+}
+
+func TestConsumeRefreshTokenRejectsUnknownAndExpired(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	if _, err := m.ConsumeRefreshToken(ctx, "not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidToken", err)
+	}
+	m.WithTTL(time.Minute, -time.Second)
+	pair, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ConsumeRefreshToken(ctx, pair.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRevokeLogsOutOneSession(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	pair, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.ParseAccessToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ParseAccessToken(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("revoked access token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := m.ConsumeRefreshToken(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh token of the revoked session: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := m.ParseAccessToken(ctx, other.AccessToken); err != nil {
+		t.Errorf("access token of another session: %v", err)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	bob := Subject{ID: 2, Name: "Bob", Email: "bob@example.com", Role: "user"}
+	a1, _ := m.IssueTokens(ctx, alice)
+	a2, _ := m.IssueTokens(ctx, alice)
+	b1, err := m.IssueTokens(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RevokeUserSessions(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range []*TokenPair{a1, a2} {
+		if _, err := m.ParseAccessToken(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("access token: err = %v, want ErrTokenRevoked", err)
+		}
+		if _, err := m.ConsumeRefreshToken(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("refresh token: err = %v, want ErrTokenRevoked", err)
+		}
+	}
+	if _, err := m.ConsumeRefreshToken(ctx, b1.RefreshToken); err != nil {
+		t.Errorf("another user's session was revoked: %v", err)
+	}
+	// A login after the revocation starts a valid session
+	fresh, err := m.IssueTokens(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ParseAccessToken(ctx, fresh.AccessToken); err != nil {
+		t.Errorf("new session after revocation: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package apperr defines the domain errors returned by repositories and
+// services. Each error has a Kind, which decides the HTTP status it maps to,
+// and a stable Code clients can rely on. Messages are written for clients;
+// underlying causes are only kept for logs.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind classifies a domain error
+type Kind string
+
+const (
+	KindValidation   Kind = "validation"
+	KindUnauthorized Kind = "unauthorized"
+	KindForbidden    Kind = "forbidden"
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+)
+
+// FieldError describes why one request field is invalid
+type FieldError struct {
+	// JSON path of the field, e.g. items[0].price
+	Field   string `json:"field" example:"email"`
+	Code    string `json:"code" example:"email"`
+	Message string `json:"message" example:"must be a valid email address"`
+}
+
+// Error is a domain error. Two errors with the same Code match with
+// errors.Is, so a sentinel still matches a copy made by WithCause or WithMessage.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields lists the invalid request fields of a validation error
+	Fields []FieldError
+	cause  error
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error   { return New(KindValidation, code, message) }
+func Unauthorized(code, message string) *Error { return New(KindUnauthorized, code, message) }
+func Forbidden(code, message string) *Error    { return New(KindForbidden, code, message) }
+func NotFound(code, message string) *Error     { return New(KindNotFound, code, message) }
+func Conflict(code, message string) *Error     { return New(KindConflict, code, message) }
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithCause returns a copy of e wrapping the error that caused it
+func (e *Error) WithCause(cause error) *Error {
+	cp := *e
+	cp.cause = cause
+	return &cp
+}
+
+// WithMessage returns a copy of e with a more specific client message
+func (e *Error) WithMessage(format string, args ...any) *Error {
+	cp := *e
+	cp.Message = fmt.Sprintf(format, args...)
+	return &cp
+}
+
+// WithFields returns a copy of e reporting the given invalid fields
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	cp := *e
+	cp.Fields = fields
+	return &cp
+}
+
+// As returns the first domain error in err's chain
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
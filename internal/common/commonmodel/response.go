@@ -1,8 +1,21 @@
 package commonmodel
 
-// ErrorResponse represents a standard error response
-type ErrorResponse struct {
-	Error   string `json:"error" example:"error message"`
-	Code    int    `json:"code,omitempty" example:"400"`
-	Details string `json:"details,omitempty" example:"Invalid user id"`
+import "go-template/internal/common/apperr"
+
+// Problem is an RFC 7807 problem details response, sent as
+// application/problem+json for every failed request
+type Problem struct {
+	// Always about:blank; the code extension identifies the problem
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"user not found"`
+	// Request path the problem occurred on
+	Instance string `json:"instance,omitempty" example:"/user/42"`
+	// Stable, machine-readable error code
+	Code string `json:"code" example:"user_not_found"`
+	// Id of the request, also sent in the X-Request-ID header
+	RequestID string `json:"request_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	// Every invalid request field, for validation errors
+	Errors []apperr.FieldError `json:"errors,omitempty"`
 }
@@ -0,0 +1,40 @@
+// Package query parses the query string parameters shared by the list endpoints.
+package query
+
+import (
+	"errors"
+	"time"
+)
+
+var errInvalidTime = errors.New("expected RFC 3339 timestamp or YYYY-MM-DD date")
+
+// ParseTime accepts RFC 3339 timestamps or YYYY-MM-DD dates and reports
+// whether v was a plain date
+func ParseTime(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err = time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, false, errInvalidTime
+	}
+	return t, true, nil
+}
+
+// ParseFrom parses an inclusive lower time bound; a plain date starts at its midnight (UTC)
+func ParseFrom(v string) (time.Time, error) {
+	t, _, err := ParseTime(v)
+	return t, err
+}
+
+// ParseTo parses an exclusive upper time bound; a plain date includes the whole day
+func ParseTo(v string) (time.Time, error) {
+	t, dateOnly, err := ParseTime(v)
+	if err != nil {
+		return t, err
+	}
+	if dateOnly {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
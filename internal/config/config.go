@@ -0,0 +1,485 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete application configuration.
+//
+// Values are merged in this order, later sources winning:
+//  1. built-in defaults (Default)
+//  2. the config file (configs/config.yaml, or -config / CONFIG_FILE)
+//  3. the profile file for the environment, e.g. configs/config.production.yaml
+//  4. environment variables (see applyEnv)
+//  5. command line flags
+type Config struct {
+	// Env selects the profile file, e.g. "development" or "production"
+	Env      string         `yaml:"env"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	Database DatabaseConfig `yaml:"database"`
+	Redis    RedisConfig    `yaml:"redis"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Policy   PolicyConfig   `yaml:"policy"`
+	Health   HealthConfig   `yaml:"health"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Log      LogConfig      `yaml:"log"`
+	Users    UsersConfig    `yaml:"users"`
+	Events   EventsConfig   `yaml:"events"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish on SIGINT/SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	// DSN is the Postgres connection string, usually set via POSTGRES_CONN
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type RedisConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// Addr returns the Redis host:port
+func (c RedisConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+type AuthConfig struct {
+	// KeysDir holds one <kid>.pem file per signing/verification key
+	KeysDir    string `yaml:"keys_dir"`
+	SigningKID string `yaml:"signing_kid"`
+	// LegacySecret verifies HS256 tokens until HS256AcceptUntil, which is
+	// required whenever it is set
+	LegacySecret     string        `yaml:"legacy_secret"`
+	HS256AcceptUntil time.Time     `yaml:"hs256_accept_until"`
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"`
+}
+
+type PolicyConfig struct {
+	File string `yaml:"file"`
+}
+
+type TracingConfig struct {
+	// Exporter is "otlp", "stdout", "file" or "none"
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the OTLP/HTTP collector host:port; when empty the
+	// exporter's default (or OTEL_EXPORTER_OTLP_ENDPOINT) is used
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends OTLP over plain HTTP
+	Insecure bool `yaml:"insecure"`
+	// File receives the spans when Exporter is "file"
+	File        string  `yaml:"file"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is json or text
+	Format string `yaml:"format"`
+}
+
+// UsersConfig controls how deleted users are kept and finally removed
+type UsersConfig struct {
+	// DeletedRetention is how long a soft-deleted user can be restored before it is purged
+	DeletedRetention time.Duration `yaml:"deleted_retention"`
+	// PurgeInterval is how often expired users are purged; 0 disables the purge
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+	// OrdersOnDelete is "restrict" (users with orders can not be deleted) or
+	// "cascade" (their orders are purged together with them)
+	OrdersOnDelete string `yaml:"orders_on_delete"`
+}
+
+// EventsConfig controls how domain events are relayed from the outbox to the broker
+type EventsConfig struct {
+	// Broker is "redis" (Redis Streams) or "memory" (handlers in this process)
+	Broker string `yaml:"broker"`
+	// Stream prefixes the Redis stream names, events go to <stream>:<aggregate>
+	Stream string `yaml:"stream"`
+	// StreamMaxLen approximately caps each stream; 0 keeps every entry
+	StreamMaxLen int `yaml:"stream_max_len"`
+	// PollInterval is how often the outbox is checked for due events; 0 disables the relay
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// MaxAttempts is how often an event is tried before it is dead-lettered
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff is the delay after the first failure; it doubles with every
+	// further failure up to MaxRetryBackoff
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
+	// PublishedRetention is how long published events stay in the outbox; 0 keeps them
+	PublishedRetention time.Duration `yaml:"published_retention"`
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds each dependency check of the readiness probe
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+}
+
+// Default returns the built-in defaults
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+		},
+		Redis: RedisConfig{Host: "127.0.0.1", Port: 6379},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+		},
+		Policy: PolicyConfig{File: "configs/policy.yaml"},
+		Health: HealthConfig{CheckTimeout: 2 * time.Second},
+		Log:    LogConfig{Level: "info", Format: "json"},
+		Users: UsersConfig{
+			DeletedRetention: 30 * 24 * time.Hour,
+			PurgeInterval:    time.Hour,
+			OrdersOnDelete:   "restrict",
+		},
+		Events: EventsConfig{
+			Broker:             "redis",
+			Stream:             "events",
+			StreamMaxLen:       100000,
+			PollInterval:       time.Second,
+			BatchSize:          100,
+			MaxAttempts:        10,
+			RetryBackoff:       time.Second,
+			MaxRetryBackoff:    5 * time.Minute,
+			PublishedRetention: 7 * 24 * time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "go-template",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, files, environment variables
+// and the given command line arguments, then validates it.
+func Load(args []string) (*Config, error) {
+	cfg, envErr, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadDatabase builds the configuration like Load but only validates the
+// database section, for tools such as the migrate command that need nothing else
+func LoadDatabase(args []string) (*DatabaseConfig, error) {
+	cfg, envErr, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(envErr, cfg.Database.Validate()); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return &cfg.Database, nil
+}
+
+// load merges every configuration source without validating the result.
+// envErr reports malformed environment variables.
+func load(args []string) (_ *Config, envErr error, _ error) {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFile := fs.String("config", "", "config file (default configs/config.yaml, env CONFIG_FILE)")
+	env := fs.String("env", "", "environment profile, e.g. production (env APP_ENV)")
+	addr := fs.String("addr", "", "HTTP listen address (env HTTP_ADDR)")
+	policyFile := fs.String("policy", "", "policy file (env POLICY_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	cfg := Default()
+
+	// The file and profile must be known before anything else is read
+	path := firstNonEmpty(*configFile, os.Getenv("CONFIG_FILE"))
+	required := path != ""
+	if path == "" {
+		path = "configs/config.yaml"
+	}
+	if err := mergeFile(cfg, path, required); err != nil {
+		return nil, nil, err
+	}
+	if e := firstNonEmpty(*env, os.Getenv("APP_ENV")); e != "" {
+		cfg.Env = e
+	}
+	profile := filepath.Join(filepath.Dir(path), fmt.Sprintf("config.%s.yaml", cfg.Env))
+	if err := mergeFile(cfg, profile, false); err != nil {
+		return nil, nil, err
+	}
+	// The profile file must not switch to another profile
+	if e := firstNonEmpty(*env, os.Getenv("APP_ENV")); e != "" {
+		cfg.Env = e
+	}
+
+	envErr = applyEnv(cfg)
+
+	if setFlags["addr"] {
+		cfg.HTTP.Addr = *addr
+	}
+	if setFlags["policy"] {
+		cfg.Policy.File = *policyFile
+	}
+	return cfg, envErr, nil
+}
+
+// mergeFile overlays the YAML file at path onto cfg. A missing file is only an
+// error if required is set.
+func mergeFile(cfg *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the environment variables that are set
+func applyEnv(cfg *Config) error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: must be an integer", key))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: must be a duration such as 15m", key))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: must be true or false", key))
+				return
+			}
+			*dst = b
+		}
+	}
+	float := func(key string, dst *float64) {
+		if v, ok := os.LookupEnv(key); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: must be a number", key))
+				return
+			}
+			*dst = f
+		}
+	}
+	ts := func(key string, dst *time.Time) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: must be an RFC 3339 timestamp", key))
+				return
+			}
+			*dst = t
+		}
+	}
+
+	str("HTTP_ADDR", &cfg.HTTP.Addr)
+	dur("HTTP_READ_HEADER_TIMEOUT", &cfg.HTTP.ReadHeaderTimeout)
+	dur("HTTP_READ_TIMEOUT", &cfg.HTTP.ReadTimeout)
+	dur("HTTP_WRITE_TIMEOUT", &cfg.HTTP.WriteTimeout)
+	dur("HTTP_IDLE_TIMEOUT", &cfg.HTTP.IdleTimeout)
+	dur("HTTP_SHUTDOWN_TIMEOUT", &cfg.HTTP.ShutdownTimeout)
+
+	str("POSTGRES_CONN", &cfg.Database.DSN)
+	num("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	dur("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+
+	str("REDIS_HOST", &cfg.Redis.Host)
+	num("REDIS_PORT", &cfg.Redis.Port)
+	str("REDIS_PASSWORD", &cfg.Redis.Password)
+	num("REDIS_DB", &cfg.Redis.DB)
+
+	str("JWT_KEYS_DIR", &cfg.Auth.KeysDir)
+	str("JWT_SIGNING_KID", &cfg.Auth.SigningKID)
+	str("JWT_SECRET", &cfg.Auth.LegacySecret)
+	ts("JWT_HS256_ACCEPT_UNTIL", &cfg.Auth.HS256AcceptUntil)
+	dur("ACCESS_TOKEN_TTL", &cfg.Auth.AccessTokenTTL)
+	dur("REFRESH_TOKEN_TTL", &cfg.Auth.RefreshTokenTTL)
+
+	str("POLICY_FILE", &cfg.Policy.File)
+
+	dur("HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+
+	dur("USER_DELETED_RETENTION", &cfg.Users.DeletedRetention)
+	dur("USER_PURGE_INTERVAL", &cfg.Users.PurgeInterval)
+	str("USER_ORDERS_ON_DELETE", &cfg.Users.OrdersOnDelete)
+
+	str("EVENTS_BROKER", &cfg.Events.Broker)
+	str("EVENTS_STREAM", &cfg.Events.Stream)
+	num("EVENTS_STREAM_MAX_LEN", &cfg.Events.StreamMaxLen)
+	dur("EVENTS_POLL_INTERVAL", &cfg.Events.PollInterval)
+	num("EVENTS_BATCH_SIZE", &cfg.Events.BatchSize)
+	num("EVENTS_MAX_ATTEMPTS", &cfg.Events.MaxAttempts)
+	dur("EVENTS_RETRY_BACKOFF", &cfg.Events.RetryBackoff)
+	dur("EVENTS_MAX_RETRY_BACKOFF", &cfg.Events.MaxRetryBackoff)
+	dur("EVENTS_PUBLISHED_RETENTION", &cfg.Events.PublishedRetention)
+
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	str("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	boolean("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	str("TRACING_FILE", &cfg.Tracing.File)
+	str("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid environment:\n%w", err)
+	}
+	return nil
+}
+
+// Validate reports every invalid or missing value at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Env != "", "env must not be empty")
+	check(c.HTTP.Addr != "", "http.addr is required (set HTTP_ADDR or -addr)")
+	check(c.HTTP.ReadHeaderTimeout > 0, "http.read_header_timeout must be positive")
+	check(c.HTTP.ReadTimeout > 0, "http.read_timeout must be positive")
+	check(c.HTTP.WriteTimeout > 0, "http.write_timeout must be positive")
+	check(c.HTTP.IdleTimeout > 0, "http.idle_timeout must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	errs = append(errs, c.Database.Validate())
+	check(c.Redis.Host != "", "redis.host is required")
+	check(c.Redis.Port > 0 && c.Redis.Port < 65536, "redis.port must be between 1 and 65535")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than access_token_ttl")
+	check(c.Policy.File != "", "policy.file is required")
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error")
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text")
+	check(c.Users.DeletedRetention >= 0, "users.deleted_retention must not be negative")
+	check(c.Users.PurgeInterval >= 0, "users.purge_interval must not be negative")
+	check(c.Users.OrdersOnDelete == "restrict" || c.Users.OrdersOnDelete == "cascade",
+		"users.orders_on_delete must be restrict or cascade")
+	check(c.Events.Broker == "redis" || c.Events.Broker == "memory", "events.broker must be redis or memory")
+	check(c.Events.Broker != "redis" || c.Events.Stream != "", "events.stream is required when events.broker is redis")
+	check(c.Events.StreamMaxLen >= 0, "events.stream_max_len must not be negative")
+	check(c.Events.PollInterval >= 0, "events.poll_interval must not be negative")
+	check(c.Events.BatchSize > 0, "events.batch_size must be positive")
+	check(c.Events.MaxAttempts > 0, "events.max_attempts must be positive")
+	check(c.Events.RetryBackoff > 0 && c.Events.MaxRetryBackoff >= c.Events.RetryBackoff,
+		"events.retry_backoff must be positive and at most events.max_retry_backoff")
+	check(c.Events.PublishedRetention >= 0, "events.published_retention must not be negative")
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		check(c.Tracing.File != "", "tracing.file is required when tracing.exporter is file")
+	default:
+		check(false, "tracing.exporter must be one of otlp, stdout, file, none")
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	// A fixed cutoff, so a leaked legacy secret stops working even if the service keeps restarting
+	check(c.Auth.LegacySecret == "" || !c.Auth.HS256AcceptUntil.IsZero(),
+		"auth.hs256_accept_until is required when auth.legacy_secret is set (set JWT_HS256_ACCEPT_UNTIL)")
+	if c.Auth.KeysDir != "" {
+		info, err := os.Stat(c.Auth.KeysDir)
+		check(err == nil && info.IsDir(),
+			"auth.keys_dir %q is not a directory (it holds one <kid>.pem per key, see configs/keys/README.md)", c.Auth.KeysDir)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// Validate checks the database settings
+func (c DatabaseConfig) Validate() error {
+	var errs []error
+	if c.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required (set POSTGRES_CONN)"))
+	}
+	if c.MaxOpenConns <= 0 {
+		errs = append(errs, errors.New("database.max_open_conns must be positive"))
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns must be between 0 and max_open_conns"))
+	}
+	if c.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database.conn_max_lifetime must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
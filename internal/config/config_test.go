@@ -0,0 +1,26 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRequiresHS256CutoffWithLegacySecret(t *testing.T) {
+	cfg := Default()
+	cfg.Database.DSN = "postgres://localhost/app"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+
+	cfg.Auth.LegacySecret = "legacy"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "auth.hs256_accept_until") {
+		t.Errorf("legacy secret without cutoff: err = %v, want hs256_accept_until required", err)
+	}
+
+	cfg.Auth.HS256AcceptUntil = time.Now().Add(72 * time.Hour)
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("legacy secret with cutoff: %v", err)
+	}
+}
@@ -2,29 +2,37 @@ package db
 
 import (
 	"database/sql"
-	"log"
-	"os"
-	"time"
+	"fmt"
 
+	"go-template/internal/config"
+
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 )
 
-var DB *sql.DB
-
-func InitDB() {
-	connStr := os.Getenv("POSTGRES_CONN")
-	var err error
-
-	DB, err = sql.Open("postgres", connStr)
+// Open connects a database/sql pool to cfg.DSN and checks the connection
+func Open(cfg config.DatabaseConfig) (*sql.DB, error) {
+	// otelsql records a span per query; statements keep their $n placeholders
+	// and argument values are never recorded
+	pool, err := otelsql.Open("postgres", cfg.DSN, otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL))
 	if err != nil {
-		log.Fatalf("Database connection failed: %v", err)
+		return nil, fmt.Errorf("database connection failed: %w", err)
 	}
 
-	DB.SetMaxOpenConns(10)
-	DB.SetMaxIdleConns(5)
-	DB.SetConnMaxLifetime(time.Hour)
+	ConfigurePool(pool, cfg)
 
-	if err := DB.Ping(); err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+	if err := pool.Ping(); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
+	return pool, nil
+}
+
+// ConfigurePool applies the configured pool limits, for both sql.DB and the
+// pool underneath GORM
+func ConfigurePool(pool *sql.DB, cfg config.DatabaseConfig) {
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 }
@@ -1,54 +1,82 @@
 package db
 
 import (
+	"context"
+	auditRepo "go-template/internal/audit/repository"
+	"go-template/internal/metrics"
 	orderRepo "go-template/internal/order/repository"
+	outboxRepo "go-template/internal/outbox/repository"
 	userRepo "go-template/internal/user/repository"
+	"log/slog"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 // TransactionManager is responsible for starting transactions
 type TransactionManager interface {
-	Begin() (UnitOfWork, error)
+	Begin(ctx context.Context) (UnitOfWork, error)
 }
 
 // UnitOfWork represents a transaction scope
 type UnitOfWork interface {
 	UserRepo() userRepo.UserRepository
 	OrderRepo() orderRepo.OrderRepository
+	// AuditRepo records audit entries that commit or roll back with the change
+	AuditRepo() auditRepo.AuditRepository
+	// OutboxRepo stores domain events that are only published once the change commits
+	OutboxRepo() outboxRepo.OutboxRepository
+	// AfterCommit registers fn to run once the transaction has committed.
+	// It is not run if the transaction is rolled back.
+	AfterCommit(fn func())
 	Commit() error
 	Rollback() error
 }
 
 // gormTxManager implements TransactionManager using GORM
 type gormTxManager struct {
-	db *gorm.DB
+	db  *gorm.DB
+	rdb *redis.Client
+	log *slog.Logger
 }
 
-// NewTransactionManager creates a new TransactionManager
-func NewTransactionManager(db *gorm.DB) TransactionManager {
-	return &gormTxManager{db: db}
+// NewTransactionManager creates a new TransactionManager. The Redis client
+// (nil without Redis) and the logger are handed to the repositories of each
+// unit of work.
+func NewTransactionManager(db *gorm.DB, rdb *redis.Client, logger *slog.Logger) TransactionManager {
+	return &gormTxManager{db: db, rdb: rdb, log: logger}
 }
 
-// Begin starts a transaction and returns a UnitOfWork
-func (m *gormTxManager) Begin() (UnitOfWork, error) {
-	tx := m.db.Begin()
+// Begin starts a transaction bound to ctx and returns a UnitOfWork.
+// Repositories of the unit of work run their queries inside the transaction.
+func (m *gormTxManager) Begin(ctx context.Context) (UnitOfWork, error) {
+	tx := m.db.WithContext(ctx).Begin()
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 
-	return &gormUnitOfWork{
-		tx:        tx,
-		userRepo:  userRepo.NewUserRepository(tx),   // 把 tx 傳進 repository
-		orderRepo: orderRepo.NewOrderRepository(tx), // 同上
-	}, nil
+	uow := &gormUnitOfWork{
+		tx:         tx,
+		orderRepo:  orderRepo.NewOrderRepository(tx, m.log), // 把 tx 傳進 repository
+		auditRepo:  auditRepo.NewAuditRepository(tx),
+		outboxRepo: outboxRepo.NewOutboxRepository(tx),
+	}
+	// The user repository drops cached users only after the commit
+	uow.userRepo = userRepo.NewUserRepositoryInTx(tx, m.rdb, m.log, uow.AfterCommit)
+	return uow, nil
 }
 
 // gormUnitOfWork is a GORM implementation of UnitOfWork
 type gormUnitOfWork struct {
-	tx        *gorm.DB
-	userRepo  userRepo.UserRepository
-	orderRepo orderRepo.OrderRepository
+	tx         *gorm.DB
+	userRepo   userRepo.UserRepository
+	orderRepo  orderRepo.OrderRepository
+	auditRepo  auditRepo.AuditRepository
+	outboxRepo outboxRepo.OutboxRepository
+	// afterCommit runs in order once Commit succeeded
+	afterCommit []func()
+	// done is set once the transaction has been committed or rolled back
+	done bool
 }
 
 func (u *gormUnitOfWork) UserRepo() userRepo.UserRepository {
@@ -59,10 +87,38 @@ func (u *gormUnitOfWork) OrderRepo() orderRepo.OrderRepository {
 	return u.orderRepo
 }
 
+func (u *gormUnitOfWork) AuditRepo() auditRepo.AuditRepository {
+	return u.auditRepo
+}
+
+func (u *gormUnitOfWork) OutboxRepo() outboxRepo.OutboxRepository {
+	return u.outboxRepo
+}
+
+func (u *gormUnitOfWork) AfterCommit(fn func()) {
+	u.afterCommit = append(u.afterCommit, fn)
+}
+
 func (u *gormUnitOfWork) Commit() error {
-	return u.tx.Commit().Error
+	u.done = true
+	if err := u.tx.Commit().Error; err != nil {
+		metrics.TxRolledBack()
+		return err
+	}
+	metrics.TxCommitted()
+	for _, fn := range u.afterCommit {
+		fn()
+	}
+	return nil
 }
 
+// Rollback aborts the transaction. It is a no-op after Commit, so callers can
+// always defer it.
 func (u *gormUnitOfWork) Rollback() error {
+	if u.done {
+		return nil
+	}
+	u.done = true
+	metrics.TxRolledBack()
 	return u.tx.Rollback().Error
 }
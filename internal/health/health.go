@@ -0,0 +1,122 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Status of a single dependency or of the whole service
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded means an optional dependency failed; the service still serves traffic
+	StatusDegraded Status = "degraded"
+	// StatusDown means a required dependency failed
+	StatusDown Status = "down"
+)
+
+// Check probes one dependency. Optional dependencies (e.g. the cache) are
+// reported as degraded instead of down when their probe fails.
+type Check struct {
+	Name     string
+	Optional bool
+	Probe    func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    Status `json:"status" example:"ok"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms" example:"3"`
+}
+
+// Report is the readiness response body
+type Report struct {
+	Status Status            `json:"status" example:"ok"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs all checks concurrently, each bounded by Timeout
+type Checker struct {
+	Timeout time.Duration
+	checks  []Check
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{Timeout: timeout, checks: checks}
+}
+
+// Run executes every check and combines the results
+func (h *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(h.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			res := h.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = res
+			switch {
+			case res.Status == StatusDown:
+				report.Status = StatusDown
+			case res.Status == StatusDegraded && report.Status == StatusOK:
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := check.Probe(ctx)
+	res := Result{Status: StatusOK, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Error = err.Error()
+		res.Status = StatusDown
+		if check.Optional {
+			res.Status = StatusDegraded
+		}
+	}
+	return res
+}
+
+// LivenessHandler godoc
+// @Summary Liveness probe
+// @Description Reports that the process is running. It does not check dependencies.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+// ReadinessHandler godoc
+// @Summary Readiness probe
+// @Description Checks the database pools and Redis. Returns 503 if a required dependency is down; an unavailable cache only makes the service degraded.
+// @Tags health
+// @Produce json
+// @Success 200 {object} Report
+// @Failure 503 {object} Report
+// @Router /readyz [get]
+func (h *Checker) ReadinessHandler(c *gin.Context) {
+	report := h.Run(c.Request.Context())
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
@@ -0,0 +1,90 @@
+// Package logging builds the application's slog logger. Records carry the
+// request id and trace id of the context they are logged with, and values of
+// secret-looking keys (passwords, tokens, ...) are redacted.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go-template/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of secret attributes
+const Redacted = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"password":      true,
+	"new_password":  true,
+	"old_password":  true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"cookie":        true,
+	"secret":        true,
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id stored in ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// New returns a JSON (or text) logger writing to w at the configured level
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	var level slog.Level
+	// Validated by config, so the level always parses
+	_ = level.UnmarshalText([]byte(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(&contextHandler{Handler: h})
+}
+
+// redact hides the value of secret attributes, at any group depth
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// contextHandler adds the request id and trace id from the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,102 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Cache lookup results
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// Outbox delivery outcomes
+const (
+	OutboxPublished = "published"
+	OutboxRetry     = "retry"
+	OutboxDead      = "dead"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Cache lookups by cache name and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+
+	transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_transactions_total",
+		Help: "Unit of work transactions by outcome (commit, rollback).",
+	}, []string{"outcome"})
+
+	outboxEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_events_total",
+		Help: "Outbox event delivery attempts by outcome (published, retry, dead).",
+	}, []string{"outcome"})
+)
+
+// Middleware records the count and latency of every request. Requests are
+// labelled with the route template (e.g. /user/:id) to keep cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDBStats exposes the pool statistics (sql.DB.Stats) of a connection pool
+func RegisterDBStats(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// CacheResult counts one cache lookup
+func CacheResult(cache, result string) {
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// TxCommitted counts a committed transaction
+func TxCommitted() {
+	transactions.WithLabelValues("commit").Inc()
+}
+
+// TxRolledBack counts a rolled back transaction
+func TxRolledBack() {
+	transactions.WithLabelValues("rollback").Inc()
+}
+
+// OutboxEvent counts one delivery attempt of an outbox event
+func OutboxEvent(outcome string) {
+	outboxEvents.WithLabelValues(outcome).Inc()
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strings"
+
+	"go-template/internal/audit/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUserAgentLen bounds the user agent kept in the audit log
+const maxUserAgentLen = 512
+
+// AuditClient stores the caller's IP and user agent in the request context so
+// audit entries written by the services can record where a change came from
+func AuditClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ua := c.Request.UserAgent()
+		if len(ua) > maxUserAgentLen {
+			ua = ua[:maxUserAgentLen]
+		}
+		// Postgres rejects invalid UTF-8, and the cut may have split a character
+		ua = strings.ToValidUTF8(ua, "")
+		client := model.Client{IP: c.ClientIP(), UserAgent: ua}
+		c.Request = c.Request.WithContext(model.WithClient(c.Request.Context(), client))
+		c.Next()
+	}
+}
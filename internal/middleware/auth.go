@@ -1,22 +1,48 @@
 package middleware
 
 import (
-	"os"
+	"go-template/internal/auth"
+	"go-template/internal/policy"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+const (
+	claimsKey    = "claims"
+	principalKey = "principal"
+)
+
+// Guard authenticates callers with the token manager and authorizes them with
+// the policy engine. Build one at startup and share it between the routers.
+type Guard struct {
+	tokens *auth.Manager
+	policy *policy.Engine
+}
+
+func NewGuard(tokens *auth.Manager, engine *policy.Engine) *Guard {
+	return &Guard{tokens: tokens, policy: engine}
+}
+
+// CurrentPrincipal returns the caller authenticated by AuthMiddleware
+func CurrentPrincipal(c *gin.Context) (*auth.Principal, bool) {
+	p, ok := c.Value(principalKey).(*auth.Principal)
+	return p, ok
+}
+
+// CurrentClaims returns the access token claims validated by AuthMiddleware
+func CurrentClaims(c *gin.Context) (*auth.Claims, bool) {
+	claims, ok := c.Value(claimsKey).(*auth.Claims)
+	return claims, ok
+}
 
 // AuthMiddleware validates JWT token from Authorization header
-func AuthMiddleware() gin.HandlerFunc {
+func (g *Guard) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
 			// If no token, return 401 Unauthorized
-			c.JSON(401, gin.H{"error": "Missing token"})
+			c.Error(ErrMissingToken)
 			c.Abort()
 			return
 		}
@@ -24,29 +50,20 @@ func AuthMiddleware() gin.HandlerFunc {
 		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
 			tokenString = tokenString[7:]
 		}
-		// Parse and validate JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Return the secret key for validation
-			return jwtSecret, nil
-		})
-		// If token is invalid or parsing fails, return 401 Unauthorized
-		if err != nil || !token.Valid {
-			c.JSON(401, gin.H{"error": "Invalid token"})
+		// Parse and validate JWT token, including the revocation list.
+		// Invalid or revoked tokens are unauthorized domain errors.
+		claims, err := g.tokens.ParseAccessToken(c.Request.Context(), tokenString)
+		if err != nil {
+			c.Error(err)
 			c.Abort()
 			return
 		}
-		// Parse JWT claims and store in Gin Context
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if email, ok := claims["email"]; ok {
-				c.Set("email", email)
-			}
-			if role, ok := claims["role"]; ok {
-				c.Set("role", role)
-			}
-			if name, ok := claims["name"]; ok {
-				c.Set("name", name)
-			}
-		}
+		// Store JWT claims and the caller in Gin Context, and the caller in
+		// the request context for the layers below the handlers
+		principal := claims.Principal()
+		c.Set(claimsKey, claims)
+		c.Set(principalKey, principal)
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
 		// Token is valid, continue to next handler
 		c.Next()
 	}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"go-template/internal/common/apperr"
+	"go-template/internal/common/commonmodel"
+
+	"github.com/gin-gonic/gin"
+)
+
+const errorCodeKey = "error_code"
+
+var (
+	ErrMissingToken  = apperr.Unauthorized("missing_token", "missing bearer token")
+	ErrForbidden     = apperr.Forbidden("forbidden", "you do not have permission to perform this action")
+	ErrRouteNotFound = apperr.NotFound("route_not_found", "no route matches the request")
+	// errInternal is sent for every error that is not a domain error, so
+	// database and driver messages never reach clients
+	errInternal = apperr.New("", "internal_error", "an unexpected error occurred")
+)
+
+// statusOf maps an error kind to its HTTP status
+var statusOf = map[apperr.Kind]int{
+	apperr.KindValidation:   http.StatusBadRequest,
+	apperr.KindUnauthorized: http.StatusUnauthorized,
+	apperr.KindForbidden:    http.StatusForbidden,
+	apperr.KindNotFound:     http.StatusNotFound,
+	apperr.KindConflict:     http.StatusConflict,
+}
+
+// Errors writes the last error a handler or middleware attached with c.Error
+// as an RFC 7807 application/problem+json response. Domain errors keep their
+// code and message; anything else is logged and answered with a generic 500.
+// Handlers report failures with c.Error(err) and return.
+func Errors(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		e, ok := apperr.As(err)
+		var status int
+		if ok {
+			status, ok = statusOf[e.Kind]
+		}
+		if !ok {
+			logger.ErrorContext(c.Request.Context(), "request failed", "error", err)
+			e, status = errInternal, http.StatusInternalServerError
+		}
+		c.Set(errorCodeKey, e.Code)
+		c.Header("Content-Type", "application/problem+json")
+		c.AbortWithStatusJSON(status, commonmodel.Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    e.Message,
+			Instance:  c.Request.URL.Path,
+			Code:      e.Code,
+			RequestID: CurrentRequestID(c),
+			Errors:    e.Fields,
+		})
+	}
+}
+
+// NotFound answers requests that match no route
+func NotFound(c *gin.Context) {
+	c.Error(ErrRouteNotFound)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLog writes one structured line per request once it has been handled.
+// The query string is left out of the path since it may carry secrets.
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if p, ok := CurrentPrincipal(c); ok {
+			attrs = append(attrs, slog.Int64("principal_id", p.ID))
+		}
+		if code := c.GetString(errorCodeKey); code != "" {
+			attrs = append(attrs, slog.String("error_code", code))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panic into an error for the Errors middleware, which must
+// run before it and renders the 500 response. The stack trace is only logged
+// here, with the request id, and never sent to the client.
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logger.ErrorContext(c.Request.Context(), "panic recovered",
+			"panic", fmt.Sprint(recovered),
+			"route", c.FullPath(),
+			"stack", string(debug.Stack()))
+		c.Error(fmt.Errorf("panic: %v", recovered))
+		c.Abort()
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OwnerResolver returns the id of the user owning the resource a request targets
+type OwnerResolver func(c *gin.Context) (int64, bool)
+
+// OwnerFromParam resolves the owner from a path parameter, e.g. /user/:id
+func OwnerFromParam(name string) OwnerResolver {
+	return func(c *gin.Context) (int64, bool) {
+		id, err := strconv.ParseInt(c.Param(name), 10, 64)
+		return id, err == nil
+	}
+}
+
+// RequirePermission allows the request if the caller's role is granted perm by
+// the policy. If an owner resolver is given, a grant of perm+":own" is enough
+// when the caller owns the target resource. Must run after AuthMiddleware.
+func (g *Guard) RequirePermission(perm string, owner ...OwnerResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ownerID int64
+		for _, resolve := range owner {
+			if id, ok := resolve(c); ok {
+				ownerID = id
+				break
+			}
+		}
+		if !g.Authorize(c, perm, ownerID) {
+			abortForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireOwnablePermission lets through callers granted perm either fully or
+// only for resources they own. Use it when the owner is only known after the
+// handler loads the resource; the handler must then call Authorize.
+func (g *Guard) RequireOwnablePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := CurrentPrincipal(c)
+		if !ok {
+			c.Error(ErrMissingToken)
+			c.Abort()
+			return
+		}
+		if !g.policy.AllowsOwn(p.Role, perm) {
+			abortForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Authorize reports whether the caller may perform perm on a resource owned by
+// ownerID (0 if the resource has no owner)
+func (g *Guard) Authorize(c *gin.Context, perm string, ownerID int64) bool {
+	p, ok := CurrentPrincipal(c)
+	if !ok {
+		return false
+	}
+	return g.policy.Can(p.Role, p.ID, perm, ownerID)
+}
+
+func abortForbidden(c *gin.Context) {
+	c.Error(ErrForbidden)
+	c.Abort()
+}
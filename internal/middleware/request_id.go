@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"go-template/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request id in both directions
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+// maxRequestIDLen bounds client supplied ids so they can't bloat log lines
+const maxRequestIDLen = 128
+
+// RequestID gives every request an id, reusing a well formed incoming
+// X-Request-ID or generating one. The id is echoed back in the response and
+// stored in the request context so every log line of the request carries it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// CurrentRequestID returns the id assigned by RequestID
+func CurrentRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// validRequestID accepts non-empty printable ASCII up to maxRequestIDLen
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,188 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"go-template/migrations"
+)
+
+func TestShippedMigrationsLoad(t *testing.T) {
+	migs, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mig := range migs {
+		if mig.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: want version %d", mig.Version, mig.Name, i+1)
+		}
+	}
+}
+
+// testSchema returns a database whose connections all use a fresh, empty schema.
+// It needs a Postgres server in TEST_POSTGRES_CONN and skips the test otherwise.
+func testSchema(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_CONN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_CONN is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA "` + schema + `"`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA "` + schema + `" CASCADE`) })
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// withSearchPath adds a search_path to a URL or key/value connection string
+func withSearchPath(dsn, schema string) string {
+	switch {
+	case !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://"):
+		return dsn + " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		return dsn + "&search_path=" + schema
+	default:
+		return dsn + "?search_path=" + schema
+	}
+}
+
+// legacySchema is a database set up before versioned migrations, with tables
+// created by hand: no role, status or currency, and a float price
+const legacySchema = `
+CREATE TABLE "user" (
+    "id"        SERIAL PRIMARY KEY,
+    "name"      VARCHAR(255) NOT NULL,
+    "email"     VARCHAR(255) NOT NULL,
+    "password"  VARCHAR(255) NOT NULL,
+    "createdAt" TIMESTAMPTZ
+);
+CREATE TABLE "order" (
+    "id"        SERIAL PRIMARY KEY,
+    "product"   VARCHAR(255) NOT NULL,
+    "price"     DOUBLE PRECISION NOT NULL,
+    "userId"    INTEGER NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+INSERT INTO "user" ("name", "email", "password") VALUES ('Alice', 'alice@example.com', 'hash');
+INSERT INTO "order" ("product", "price", "userId") VALUES ('Book', 19.99, 1), ('Pen', 0.1, 1);
+`
+
+func TestUpAdoptsExistingSchema(t *testing.T) {
+	ctx := context.Background()
+	db := testSchema(t)
+	if _, err := db.ExecContext(ctx, legacySchema); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.migrations) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(m.migrations))
+	}
+
+	var role string
+	var createdAt *time.Time
+	if err := db.QueryRowContext(ctx, `SELECT "role", "createdAt" FROM "user" WHERE "id" = 1`).Scan(&role, &createdAt); err != nil {
+		t.Fatal(err)
+	}
+	if role != "user" || createdAt == nil {
+		t.Errorf("adopted user: role %q, createdAt %v; want role \"user\" and a creation time", role, createdAt)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT "priceAmount", "priceCurrency", "status" FROM "order" ORDER BY "id"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var amounts []int64
+	for rows.Next() {
+		var amount int64
+		var currency, status string
+		if err := rows.Scan(&amount, &currency, &status); err != nil {
+			t.Fatal(err)
+		}
+		if currency != "USD" || status != "pending" {
+			t.Errorf("adopted order: currency %q, status %q; want USD and pending", currency, status)
+		}
+		amounts = append(amounts, amount)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 || amounts[0] != 1999 || amounts[1] != 10 {
+		t.Errorf("adopted order amounts = %v, want [1999 10]", amounts)
+	}
+
+	var priceColumns, history int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'order' AND column_name = 'price'`).Scan(&priceColumns); err != nil {
+		t.Fatal(err)
+	}
+	if priceColumns != 0 {
+		t.Error("the float price column was not dropped")
+	}
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM "order_status_history" WHERE "toStatus" = 'pending'`).Scan(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history != 2 {
+		t.Errorf("adopted orders have %d history entries, want 2", history)
+	}
+
+	// The foreign key added to the adopted table must hold for new rows
+	if _, err := db.ExecContext(ctx, `INSERT INTO "order" ("product", "priceAmount", "priceCurrency", "userId") VALUES ('Ghost', 1, 'USD', 999)`); err == nil {
+		t.Error("an order for a missing user was accepted")
+	}
+
+	again, err := m.Up(ctx)
+	if err != nil || len(again) != 0 {
+		t.Errorf("second Up applied %d migrations, err %v; want none", len(again), err)
+	}
+}
+
+func TestUpDownOnEmptySchema(t *testing.T) {
+	ctx := context.Background()
+	db := testSchema(t)
+	m, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := m.Down(ctx, len(m.migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(m.migrations) {
+		t.Errorf("reverted %d migrations, want %d", len(reverted), len(m.migrations))
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Errorf("Up after a full Down: %v", err)
+	}
+}
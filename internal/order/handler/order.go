@@ -1,42 +1,442 @@
 package handler
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 
-	"go-template/internal/order/repository"
+	"go-template/internal/common/apperr"
+	"go-template/internal/common/query"
+	"go-template/internal/middleware"
+	"go-template/internal/order/model"
 	"go-template/internal/order/service"
+	"go-template/internal/validation"
+	"go-template/pkg/money"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-// GetOrderHandler godoc
+// OrderService is the order business logic the handlers depend on
+type OrderService interface {
+	GetOrderByID(ctx context.Context, id int64) (*model.Order, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, int64, error)
+	CreateOrder(ctx context.Context, order *model.Order, actorID int64) error
+	UpdateOrder(ctx context.Context, id int64, update service.OrderUpdate, authorize service.Authorizer) (*model.Order, error)
+	ChangeStatus(ctx context.Context, id int64, to string, actorID int64, authorize service.Authorizer) (*model.Order, error)
+	CancelOrder(ctx context.Context, id int64, actorID int64, authorize service.Authorizer) (*model.Order, error)
+	GetStatusHistory(ctx context.Context, id int64, authorize service.Authorizer) ([]*model.OrderStatusHistory, error)
+}
+
+var (
+	errInvalidOrderID = apperr.Validation("invalid_order_id", "order id must be a valid integer")
+	errInvalidQuery   = apperr.Validation("invalid_query", "invalid query parameters")
+)
+
+// OrderHandler serves the order API. Failures are passed to the Errors
+// middleware with c.Error.
+type OrderHandler struct {
+	orders OrderService
+	guard  *middleware.Guard
+	log    *slog.Logger
+}
+
+// NewOrderHandler creates the order handlers. guard protects the routes and
+// checks access to loaded orders. Failures go to the Errors middleware;
+// logger records denied access to other users' orders.
+func NewOrderHandler(orders OrderService, guard *middleware.Guard, logger *slog.Logger) *OrderHandler {
+	return &OrderHandler{orders: orders, guard: guard, log: logger}
+}
+
+// GetOrder godoc
 // @Summary Get order info
-// @Description Get order data by ID
+// @Description Get order data by ID. Orders of other users are reported as not found unless the caller may read every order.
 // @Tags order
+// @Security BearerAuth
 // @Param id path int true "Order ID"
 // @Success 200 {object} model.Order
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
 // @Router /order/{id} [get]
-func GetOrderHandler(c *gin.Context) {
-	// db := c.MustGet("db").(*sql.DB)
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewOrderRepository(db)
-	orderService := service.NewOrderService(repo)
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	id, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	order, err := h.orders.GetOrderByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	// Admins may read any order, users only their own
+	if err := h.orderAccess(c, "order:read")(order); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// OrderItemRequest represents one line item of an order request
+type OrderItemRequest struct {
+	ProductID int64  `json:"product_id" binding:"gte=0" example:"42"`
+	Name      string `json:"name" binding:"required,max=255" example:"Laptop"`
+	Quantity  int    `json:"quantity" binding:"gt=0,max=10000" example:"1"`
+	// Unit price in minor units of its currency, must be positive
+	Price money.Money `json:"price" binding:"money"`
+}
+
+// CreateOrderRequest represents the request body for creating an order.
+// The order price is the sum of the item prices times their quantities.
+// swagger:model
+type CreateOrderRequest struct {
+	// Owner of the order; defaults to the caller. Only admins may create orders for other users.
+	UserID int64 `json:"user_id" binding:"gte=0" example:"1"`
+	// Short description; defaults to the first item's name
+	Product string             `json:"product" binding:"max=255" example:"Laptop"`
+	Items   []OrderItemRequest `json:"items" binding:"required,min=1,max=100,dive"`
+}
+
+// UpdateOrderRequest represents a partial order update; omitted fields are left unchanged.
+// Sending items replaces all line items and recalculates the price.
+// swagger:model
+type UpdateOrderRequest struct {
+	Product *string             `json:"product,omitempty" binding:"omitnil,min=1,max=255" example:"Laptop"`
+	Items   *[]OrderItemRequest `json:"items,omitempty" binding:"omitnil,min=1,max=100,dive"`
+}
+
+func toOrderItems(reqs []OrderItemRequest) []model.OrderItem {
+	items := make([]model.OrderItem, 0, len(reqs))
+	for _, r := range reqs {
+		items = append(items, model.OrderItem{
+			ProductID: r.ProductID,
+			Name:      r.Name,
+			Quantity:  r.Quantity,
+			Price:     r.Price,
+		})
+	}
+	return items
+}
+
+// OrderListResponse is one page of orders
+type OrderListResponse struct {
+	Items    []*model.Order `json:"items"`
+	Total    int64          `json:"total" example:"42"`
+	Page     int            `json:"page" example:"1"`
+	PageSize int            `json:"page_size" example:"20"`
+}
+
+// CreateOrder godoc
+// @Summary Create order
+// @Description Create a new pending order. Its price is derived from the line items.
+// @Tags order
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param order body CreateOrderRequest true "Order Info"
+// @Success 201 {object} model.Order
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /order [post]
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	var req CreateOrderRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	if req.UserID == 0 {
+		principal, _ := middleware.CurrentPrincipal(c)
+		req.UserID = principal.ID
+	}
+	if !h.guard.Authorize(c, "order:create", req.UserID) {
+		h.logDenied(c, "order:create", 0, req.UserID)
+		c.Error(middleware.ErrForbidden.WithMessage("you do not have permission to create orders for this user"))
+		return
+	}
+	order := &model.Order{
+		Product: req.Product,
+		UserID:  req.UserID,
+		Items:   toOrderItems(req.Items),
+	}
+	principal, _ := middleware.CurrentPrincipal(c)
+	if err := h.orders.CreateOrder(c.Request.Context(), order, principal.ID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+// ListOrders godoc
+// @Summary List orders
+// @Description List orders newest first. Admins see all orders, other users only their own.
+// @Tags order
+// @Security BearerAuth
+// @Produce json
+// @Param user_id query int false "Filter by user ID"
+// @Param from query string false "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC 3339), or on or before a YYYY-MM-DD date"
+// @Param currency query string false "Order currency (ISO 4217)"
+// @Param min_price query int false "Minimum total, in minor units"
+// @Param max_price query int false "Maximum total, in minor units"
+// @Param page query int false "Page number, starting at 1" default(1)
+// @Param page_size query int false "Page size (max 100)" default(20)
+// @Success 200 {object} OrderListResponse
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /orders [get]
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		c.Error(errInvalidQuery.WithMessage("%s", err))
+		return
+	}
+	// Callers without the full order:list permission are limited to their own orders
+	if !h.guard.Authorize(c, "order:list", 0) {
+		principal, _ := middleware.CurrentPrincipal(c)
+		if filter.UserID != 0 && filter.UserID != principal.ID {
+			c.Error(middleware.ErrForbidden.WithMessage("you may only list your own orders"))
+			return
+		}
+		filter.UserID = principal.ID
+	}
+	orders, total, err := h.orders.ListOrders(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		c.Error(err)
+		return
+	}
+	filter.Normalize()
+	if orders == nil {
+		orders = []*model.Order{}
+	}
+	c.JSON(http.StatusOK, OrderListResponse{
+		Items:    orders,
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	})
+}
+
+// UpdateOrder godoc
+// @Summary Update order
+// @Description Change the product description or line items of a pending order
+// @Tags order
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param order body UpdateOrderRequest true "Fields to change"
+// @Success 200 {object} model.Order
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /order/{id} [patch]
+func (h *OrderHandler) UpdateOrder(c *gin.Context) {
+	id, ok := parseOrderID(c)
+	if !ok {
 		return
 	}
-	order, err := orderService.GetOrderByID(id)
-	if err == sql.ErrNoRows || order == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	var req UpdateOrderRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+	update := service.OrderUpdate{Product: req.Product}
+	if req.Items != nil {
+		items := toOrderItems(*req.Items)
+		update.Items = &items
+	}
+	order, err := h.orders.UpdateOrder(c.Request.Context(), id, update, h.orderAccess(c, "order:update"))
+	if err != nil {
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, order)
 }
+
+// CancelOrder godoc
+// @Summary Cancel order
+// @Description Cancel an order that has not been fulfilled yet
+// @Tags order
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} model.Order
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /order/{id}/cancel [post]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	id, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	principal, _ := middleware.CurrentPrincipal(c)
+	order, err := h.orders.CancelOrder(c.Request.Context(), id, principal.ID, h.orderAccess(c, "order:cancel"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// ChangeOrderStatusRequest represents a request to move an order to a new status
+// swagger:model
+type ChangeOrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=pending paid fulfilled shipped delivered cancelled refunded" example:"paid" enums:"pending,paid,fulfilled,shipped,delivered,cancelled,refunded"`
+}
+
+// ChangeOrderStatus godoc
+// @Summary Change order status
+// @Description Move an order along its lifecycle: pending → paid → fulfilled → shipped → delivered, or to cancelled (before fulfilment) / refunded (after payment). Illegal transitions return 409.
+// @Tags order
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param request body ChangeOrderStatusRequest true "New status"
+// @Success 200 {object} model.Order
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /order/{id}/status [post]
+func (h *OrderHandler) ChangeOrderStatus(c *gin.Context) {
+	id, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	var req ChangeOrderStatusRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	principal, _ := middleware.CurrentPrincipal(c)
+	order, err := h.orders.ChangeStatus(c.Request.Context(), id, req.Status, principal.ID, h.orderAccess(c, "order:status"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderHistory godoc
+// @Summary Get order status history
+// @Description List every status change of an order with the acting user and time, oldest first
+// @Tags order
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} model.OrderStatusHistory
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /order/{id}/history [get]
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	id, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	history, err := h.orders.GetStatusHistory(c.Request.Context(), id, h.orderAccess(c, "order:read"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if history == nil {
+		history = []*model.OrderStatusHistory{}
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func parseOrderID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidOrderID)
+		return 0, false
+	}
+	return id, true
+}
+
+// orderAccess checks the caller may perform perm on an order once the service
+// has loaded it. An order the caller may not touch is reported as not found,
+// like a missing one, so order ids of other users can not be probed.
+func (h *OrderHandler) orderAccess(c *gin.Context, perm string) service.Authorizer {
+	return func(order *model.Order) error {
+		if !h.guard.Authorize(c, perm, order.UserID) {
+			h.logDenied(c, perm, order.ID, order.UserID)
+			return model.ErrOrderNotFound
+		}
+		return nil
+	}
+}
+
+// logDenied records a caller trying to act on an order they may not touch,
+// which the route permission could not rule out before the order was loaded
+func (h *OrderHandler) logDenied(c *gin.Context, perm string, orderID, ownerID int64) {
+	principal, _ := middleware.CurrentPrincipal(c)
+	h.log.WarnContext(c.Request.Context(), "order access denied",
+		"permission", perm, "order_id", orderID, "owner_id", ownerID, "principal_id", principal.ID)
+}
+
+// parseOrderFilter reads the list filters from the query string
+func parseOrderFilter(c *gin.Context) (model.OrderFilter, error) {
+	var f model.OrderFilter
+	var err error
+	if v := c.Query("user_id"); v != "" {
+		if f.UserID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("user_id must be an integer")
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := query.ParseFrom(v)
+		if err != nil {
+			return f, fmt.Errorf("from: %w", err)
+		}
+		f.CreatedFrom = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := query.ParseTo(v)
+		if err != nil {
+			return f, fmt.Errorf("to: %w", err)
+		}
+		f.CreatedTo = &t
+	}
+	if v := c.Query("currency"); v != "" {
+		if !money.IsValidCurrency(v) {
+			return f, fmt.Errorf("currency must be a supported ISO 4217 code")
+		}
+		f.Currency = v
+	}
+	if v := c.Query("min_price"); v != "" {
+		p, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("min_price must be an integer amount in minor units")
+		}
+		f.MinPrice = &p
+	}
+	if v := c.Query("max_price"); v != "" {
+		p, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("max_price must be an integer amount in minor units")
+		}
+		f.MaxPrice = &p
+	}
+	if v := c.Query("page"); v != "" {
+		if f.Page, err = strconv.Atoi(v); err != nil {
+			return f, fmt.Errorf("page must be an integer")
+		}
+	}
+	if v := c.Query("page_size"); v != "" {
+		if f.PageSize, err = strconv.Atoi(v); err != nil {
+			return f, fmt.Errorf("page_size must be an integer")
+		}
+	}
+	return f, nil
+}
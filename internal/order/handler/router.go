@@ -2,6 +2,13 @@ package handler
 
 import "github.com/gin-gonic/gin"
 
-func RegisterOrderRoutes(r *gin.Engine) {
-	r.GET("/order/:id", GetOrderHandler)
+func RegisterOrderRoutes(r *gin.Engine, h *OrderHandler) {
+	auth := h.guard.AuthMiddleware()
+	r.POST("/order", auth, h.guard.RequireOwnablePermission("order:create"), h.CreateOrder)
+	r.GET("/orders", auth, h.guard.RequireOwnablePermission("order:list"), h.ListOrders)
+	r.GET("/order/:id", auth, h.guard.RequireOwnablePermission("order:read"), h.GetOrder)
+	r.PATCH("/order/:id", auth, h.guard.RequireOwnablePermission("order:update"), h.UpdateOrder)
+	r.POST("/order/:id/cancel", auth, h.guard.RequireOwnablePermission("order:cancel"), h.CancelOrder)
+	r.POST("/order/:id/status", auth, h.guard.RequireOwnablePermission("order:status"), h.ChangeOrderStatus)
+	r.GET("/order/:id/history", auth, h.guard.RequireOwnablePermission("order:read"), h.GetOrderHistory)
 }
@@ -1,6 +1,12 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"go-template/internal/common/apperr"
+	"go-template/pkg/money"
+)
 
 // TableName sets the table name for GORM to 'order' (not the default 'orders')
 func (Order) TableName() string {
@@ -8,18 +14,121 @@ func (Order) TableName() string {
 }
 
 type Order struct {
-	ID        int64     `json:"id"`
-	Product   string    `json:"product"`
-	Price     float64   `json:"price"`
-	UserID    int64     `json:"user_id" gorm:"column:userId"`
-	CreatedAt time.Time `json:"created_at" gorm:"column:createdAt"`
-	// Items is a slice of order items, ignored by GORM (not stored in DB)
-	Items []OrderItem `json:"items" gorm:"-"`
+	ID      int64  `json:"id"`
+	Product string `json:"product"`
+	// Total of the line items
+	Price     money.Money `json:"price" gorm:"embedded;embeddedPrefix:price"`
+	UserID    int64       `json:"user_id" gorm:"column:userId"`
+	Status    string      `json:"status" example:"pending"`
+	CreatedAt time.Time   `json:"created_at" gorm:"column:createdAt"`
+	// Items are the order's line items, stored in the order_item table
+	Items []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
+}
+
+// TableName sets the table name for GORM to 'order_item'
+func (OrderItem) TableName() string {
+	return "order_item"
 }
 
+// OrderItem is a line of an order; Price is the unit price
 type OrderItem struct {
-	ProductID int64   `json:"product_id"`
-	Name      string  `json:"name"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID        int64  `json:"id"`
+	OrderID   int64  `json:"order_id" gorm:"column:orderId"`
+	ProductID int64  `json:"product_id" gorm:"column:productId"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	// Unit price
+	Price money.Money `json:"price" gorm:"embedded;embeddedPrefix:price"`
+}
+
+var (
+	ErrOrderNotFound   = apperr.NotFound("order_not_found", "order not found")
+	ErrUnknownUser     = apperr.Validation("unknown_user", "the order's user does not exist")
+	ErrNoItems         = apperr.Validation("no_items", "order must have at least one item")
+	ErrInvalidItem     = apperr.Validation("invalid_item", "order items need a name, a positive quantity and a positive price in a supported currency")
+	ErrMixedCurrencies = apperr.Validation("mixed_currencies", "all order items must use the same currency")
+	ErrPriceOverflow   = apperr.Validation("price_out_of_range", "the order total is too large")
+)
+
+// PrepareItems validates the line items, derives the order price from them and
+// defaults the product description to the first item's name.
+func (o *Order) PrepareItems() error {
+	if len(o.Items) == 0 {
+		return ErrNoItems
+	}
+	for _, item := range o.Items {
+		if item.Name == "" || item.Quantity <= 0 || !item.Price.IsPositive() || item.Price.Validate() != nil {
+			return ErrInvalidItem
+		}
+	}
+	if o.Product == "" {
+		o.Product = o.Items[0].Name
+	}
+	return o.CalculatePrice()
+}
+
+// CalculatePrice sets the order price to the sum of its line totals.
+// Amounts are in minor units, so the total is exact.
+func (o *Order) CalculatePrice() error {
+	if len(o.Items) == 0 {
+		return ErrNoItems
+	}
+	total := money.Money{Currency: o.Items[0].Price.Currency}
+	for _, item := range o.Items {
+		line, err := item.LineTotal()
+		if err != nil {
+			return ErrPriceOverflow
+		}
+		total, err = total.Add(line)
+		if errors.Is(err, money.ErrCurrencyMismatch) {
+			return ErrMixedCurrencies
+		}
+		if err != nil {
+			return ErrPriceOverflow
+		}
+	}
+	o.Price = total
+	return nil
+}
+
+// LineTotal returns the unit price times the quantity
+func (i OrderItem) LineTotal() (money.Money, error) {
+	return i.Price.Mul(int64(i.Quantity))
+}
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// OrderFilter selects orders for listing. Zero values mean "no filter".
+type OrderFilter struct {
+	UserID int64
+	// CreatedFrom is inclusive, CreatedTo is exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Currency, MinPrice and MaxPrice filter on the order total; prices are in minor units
+	Currency string
+	MinPrice *int64
+	MaxPrice *int64
+	Page     int
+	PageSize int
+}
+
+// Normalize applies the default page and clamps the page size
+func (f *OrderFilter) Normalize() {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize < 1 {
+		f.PageSize = DefaultPageSize
+	}
+	if f.PageSize > MaxPageSize {
+		f.PageSize = MaxPageSize
+	}
+}
+
+// Offset returns the number of rows to skip for the current page
+func (f *OrderFilter) Offset() int {
+	return (f.Page - 1) * f.PageSize
 }
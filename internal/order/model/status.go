@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// Order statuses. An order moves forward through
+// pending → paid → fulfilled → shipped → delivered, and can branch off to
+// cancelled (before fulfilment) or refunded (after payment).
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+// orderTransitions lists the statuses each status may move to
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusFulfilled: {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// IsValidOrderStatus reports whether status is a known order status
+func IsValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TableName sets the table name for GORM to 'order_status_history'
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+// OrderStatusHistory records one status change of an order.
+// FromStatus is empty for the entry written when the order is created.
+type OrderStatusHistory struct {
+	ID         int64     `json:"id"`
+	OrderID    int64     `json:"order_id" gorm:"column:orderId"`
+	FromStatus string    `json:"from_status" gorm:"column:fromStatus" example:"pending"`
+	ToStatus   string    `json:"to_status" gorm:"column:toStatus" example:"paid"`
+	ActorID    int64     `json:"actor_id" gorm:"column:actorId" example:"1"`
+	ChangedAt  time.Time `json:"changed_at" gorm:"column:changedAt"`
+}
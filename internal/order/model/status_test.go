@@ -0,0 +1,71 @@
+package model
+
+import "testing"
+
+var allStatuses = []string{
+	OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped,
+	OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded,
+}
+
+// legalTransitions is the order lifecycle spelled out, independently of orderTransitions
+var legalTransitions = map[[2]string]bool{
+	{OrderStatusPending, OrderStatusPaid}:       true,
+	{OrderStatusPending, OrderStatusCancelled}:  true,
+	{OrderStatusPaid, OrderStatusFulfilled}:     true,
+	{OrderStatusPaid, OrderStatusCancelled}:     true, // owners may cancel a paid order (order:cancel:own)
+	{OrderStatusPaid, OrderStatusRefunded}:      true,
+	{OrderStatusFulfilled, OrderStatusShipped}:  true,
+	{OrderStatusFulfilled, OrderStatusRefunded}: true,
+	{OrderStatusShipped, OrderStatusDelivered}:  true,
+	{OrderStatusShipped, OrderStatusRefunded}:   true,
+	{OrderStatusDelivered, OrderStatusRefunded}: true,
+}
+
+func TestCanTransition(t *testing.T) {
+	// Every pair of statuses: the legal ones above and nothing else
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := legalTransitions[[2]string{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestCanTransitionRejectsIllegalMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"skip payment", OrderStatusPending, OrderStatusShipped},
+		{"refund before payment", OrderStatusPending, OrderStatusRefunded},
+		{"cancel after fulfilment", OrderStatusFulfilled, OrderStatusCancelled},
+		{"cancel after shipping", OrderStatusShipped, OrderStatusCancelled},
+		{"move backwards", OrderStatusShipped, OrderStatusPaid},
+		{"reopen a cancelled order", OrderStatusCancelled, OrderStatusPending},
+		{"leave refunded", OrderStatusRefunded, OrderStatusPaid},
+		{"same status", OrderStatusPaid, OrderStatusPaid},
+		{"unknown from", "archived", OrderStatusPaid},
+		{"unknown to", OrderStatusPending, "archived"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if CanTransition(tt.from, tt.to) {
+			t.Errorf("%s: CanTransition(%q, %q) = true", tt.name, tt.from, tt.to)
+		}
+	}
+}
+
+func TestIsValidOrderStatus(t *testing.T) {
+	for _, s := range allStatuses {
+		if !IsValidOrderStatus(s) {
+			t.Errorf("IsValidOrderStatus(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "archived", "PAID"} {
+		if IsValidOrderStatus(s) {
+			t.Errorf("IsValidOrderStatus(%q) = true", s)
+		}
+	}
+}
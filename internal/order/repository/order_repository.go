@@ -1,38 +1,64 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"go-template/internal/order/model"
+	"log/slog"
 
 	"gorm.io/gorm"
 )
 
 // OrderRepository defines the contract for order data access.
 // This interface allows you to abstract the data layer and easily switch implementations (e.g., GORM, SQL, mock).
+// Orders are always returned with their items loaded.
 type OrderRepository interface {
 	// GetOrderByID returns an order by its ID. Returns nil if not found.
-	GetOrderByID(id int64) (*model.Order, error)
+	GetOrderByID(ctx context.Context, id int64) (*model.Order, error)
 	// GetOrdersByUserID returns all orders for a given user ID.
-	GetOrdersByUserID(userID int64) ([]*model.Order, error)
-	// CreateOrder creates a new order in the database.
-	CreateOrder(order *model.Order) error
+	GetOrdersByUserID(ctx context.Context, userID int64) ([]*model.Order, error)
+	// ListOrders returns one page of orders matching the filter and the total number of matches.
+	ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, int64, error)
+	// CreateOrder creates a new order and its items in the database.
+	CreateOrder(ctx context.Context, order *model.Order) error
+	// UpdateOrder saves the product and price of a pending order. It fails with a
+	// not-found error if the order does not exist or is no longer pending.
+	UpdateOrder(ctx context.Context, order *model.Order) error
+	// ReplaceOrderItems replaces all items of an order; IDs are set on the given items.
+	ReplaceOrderItems(ctx context.Context, orderID int64, items []model.OrderItem) error
+	// UpdateOrderStatus moves an order from one status to another. It fails with a
+	// not-found error if the order does not exist or is no longer in the from status.
+	UpdateOrderStatus(ctx context.Context, id int64, from, to string) error
+	// AddStatusHistory records a status change.
+	AddStatusHistory(ctx context.Context, entry *model.OrderStatusHistory) error
+	// GetStatusHistory returns the status changes of an order, oldest first.
+	GetStatusHistory(ctx context.Context, orderID int64) ([]*model.OrderStatusHistory, error)
 }
 
 // GormOrderRepository is a GORM-based implementation of the OrderRepository interface.
 // It holds a *gorm.DB instance and provides methods to access order data using GORM ORM.
 type GormOrderRepository struct {
-	DB *gorm.DB
+	DB  *gorm.DB
+	Log *slog.Logger
 }
 
 // NewOrderRepository returns an OrderRepository implemented with GORM.
 // Pass a *gorm.DB instance to use as the database connection.
 // This allows you to depend on the interface rather than a concrete implementation.
-func NewOrderRepository(db *gorm.DB) OrderRepository {
-	return &GormOrderRepository{DB: db}
+func NewOrderRepository(db *gorm.DB, logger *slog.Logger) OrderRepository {
+	return &GormOrderRepository{DB: db, Log: logger}
 }
 
-func (r *GormOrderRepository) GetOrderByID(id int64) (*model.Order, error) {
+// withItems eager loads order items in a stable order
+func withItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order(`"id"`)
+	})
+}
+
+func (r *GormOrderRepository) GetOrderByID(ctx context.Context, id int64) (*model.Order, error) {
 	var order model.Order
-	result := r.DB.First(&order, id)
+	result := withItems(r.DB.WithContext(ctx)).First(&order, id)
 	if result.Error == gorm.ErrRecordNotFound {
 		return nil, nil
 	}
@@ -42,17 +68,110 @@ func (r *GormOrderRepository) GetOrderByID(id int64) (*model.Order, error) {
 	return &order, nil
 }
 
-func (r *GormOrderRepository) GetOrdersByUserID(userID int64) ([]*model.Order, error) {
+func (r *GormOrderRepository) GetOrdersByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
 	var orders []*model.Order
-	result := r.DB.Where("user_id = ?", userID).Find(&orders)
+	result := withItems(r.DB.WithContext(ctx)).Where(`"userId" = ?`, userID).Find(&orders)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return orders, nil
 }
 
-// CreateOrder inserts a new order into the database using GORM
-func (r *GormOrderRepository) CreateOrder(order *model.Order) error {
-	result := r.DB.Create(order)
+// ListOrders returns orders newest first, paginated by page and page size
+func (r *GormOrderRepository) ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, int64, error) {
+	filter.Normalize()
+	q := r.DB.WithContext(ctx).Model(&model.Order{})
+	if filter.UserID != 0 {
+		q = q.Where(`"userId" = ?`, filter.UserID)
+	}
+	if filter.CreatedFrom != nil {
+		q = q.Where(`"createdAt" >= ?`, *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		q = q.Where(`"createdAt" < ?`, *filter.CreatedTo)
+	}
+	if filter.Currency != "" {
+		q = q.Where(`"priceCurrency" = ?`, filter.Currency)
+	}
+	if filter.MinPrice != nil {
+		q = q.Where(`"priceAmount" >= ?`, *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		q = q.Where(`"priceAmount" <= ?`, *filter.MaxPrice)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var orders []*model.Order
+	result := withItems(q).Order(`"createdAt" DESC, "id" DESC`).Limit(filter.PageSize).Offset(filter.Offset()).Find(&orders)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return orders, total, nil
+}
+
+// CreateOrder inserts a new order and its items using GORM.
+// Run it inside a UnitOfWork so the order and items are written atomically.
+func (r *GormOrderRepository) CreateOrder(ctx context.Context, order *model.Order) error {
+	result := r.DB.WithContext(ctx).Create(order)
+	if errors.Is(result.Error, gorm.ErrForeignKeyViolated) {
+		r.Log.WarnContext(ctx, "order references an unknown user", "user_id", order.UserID)
+		return model.ErrUnknownUser
+	}
 	return result.Error
 }
+
+func (r *GormOrderRepository) UpdateOrder(ctx context.Context, order *model.Order) error {
+	result := r.DB.WithContext(ctx).Model(&model.Order{ID: order.ID}).
+		Where(`"status" = ?`, model.OrderStatusPending).
+		Select("product", "priceAmount", "priceCurrency").Updates(order)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		r.Log.InfoContext(ctx, "order not updated, it is missing or no longer pending", "order_id", order.ID)
+		return model.ErrOrderNotFound
+	}
+	return nil
+}
+
+func (r *GormOrderRepository) ReplaceOrderItems(ctx context.Context, orderID int64, items []model.OrderItem) error {
+	if err := r.DB.WithContext(ctx).Where(`"orderId" = ?`, orderID).Delete(&model.OrderItem{}).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	for i := range items {
+		items[i].ID = 0
+		items[i].OrderID = orderID
+	}
+	return r.DB.WithContext(ctx).Create(&items).Error
+}
+
+func (r *GormOrderRepository) UpdateOrderStatus(ctx context.Context, id int64, from, to string) error {
+	result := r.DB.WithContext(ctx).Model(&model.Order{}).Where(`"id" = ? AND "status" = ?`, id, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		r.Log.InfoContext(ctx, "order status not changed, it is missing or no longer "+from, "order_id", id, "to", to)
+		return model.ErrOrderNotFound
+	}
+	return nil
+}
+
+func (r *GormOrderRepository) AddStatusHistory(ctx context.Context, entry *model.OrderStatusHistory) error {
+	return r.DB.WithContext(ctx).Create(entry).Error
+}
+
+func (r *GormOrderRepository) GetStatusHistory(ctx context.Context, orderID int64) ([]*model.OrderStatusHistory, error) {
+	var history []*model.OrderStatusHistory
+	result := r.DB.WithContext(ctx).Where(`"orderId" = ?`, orderID).Order(`"changedAt", "id"`).Find(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return history, nil
+}
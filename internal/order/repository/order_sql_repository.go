@@ -1,60 +1,300 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"go-template/internal/order/model"
+	"log/slog"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 // OrderSqlRepository defines the contract for order data access
 type OrderSqlRepository interface {
-	GetOrderByID(id int64) (*model.Order, error)
-	GetOrdersByUserID(userID int64) ([]*model.Order, error)
+	GetOrderByID(ctx context.Context, id int64) (*model.Order, error)
+	GetOrdersByUserID(ctx context.Context, userID int64) ([]*model.Order, error)
+	ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, int64, error)
+	CreateOrder(ctx context.Context, order *model.Order) error
+	UpdateOrder(ctx context.Context, order *model.Order) error
+	ReplaceOrderItems(ctx context.Context, orderID int64, items []model.OrderItem) error
+	UpdateOrderStatus(ctx context.Context, id int64, from, to string) error
+	AddStatusHistory(ctx context.Context, entry *model.OrderStatusHistory) error
+	GetStatusHistory(ctx context.Context, orderID int64) ([]*model.OrderStatusHistory, error)
 }
 
 // GetOrdersByUserID returns all orders for a given user ID
-func (r *OrderSqlRepositoryImpl) GetOrdersByUserID(userID int64) ([]*model.Order, error) {
-	rows, err := r.DB.Query(
-		`SELECT "id", "product", "price", "userId", "createdAt" FROM public."order" WHERE "userId" = $1`,
+func (r *OrderSqlRepositoryImpl) GetOrdersByUserID(ctx context.Context, userID int64) ([]*model.Order, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT "id", "product", "priceAmount", "priceCurrency", "userId", "status", "createdAt" FROM public."order" WHERE "userId" = $1`,
 		userID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-
-	var orders []*model.Order
-	for rows.Next() {
-		var order model.Order
-		if err := rows.Scan(&order.ID, &order.Product, &order.Price, &order.UserID, &order.CreatedAt); err != nil {
-			return nil, err
-		}
-		orders = append(orders, &order)
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
 	}
-	if err := rows.Err(); err != nil {
+	if err := r.loadItems(ctx, orders); err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
 type OrderSqlRepositoryImpl struct {
-	DB *sql.DB
+	DB  *sql.DB
+	Log *slog.Logger
 }
 
-func NewOrderSqlRepository(db *sql.DB) OrderSqlRepository {
-	return &OrderSqlRepositoryImpl{DB: db}
+func NewOrderSqlRepository(db *sql.DB, logger *slog.Logger) OrderSqlRepository {
+	return &OrderSqlRepositoryImpl{DB: db, Log: logger}
 }
 
-func (r *OrderSqlRepositoryImpl) GetOrderByID(id int64) (*model.Order, error) {
+func (r *OrderSqlRepositoryImpl) GetOrderByID(ctx context.Context, id int64) (*model.Order, error) {
 	var order model.Order
-	err := r.DB.QueryRow(
-		`SELECT "id", "product", "price", "userId", "createdAt" FROM public."order" 
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT "id", "product", "priceAmount", "priceCurrency", "userId", "status", "createdAt" FROM public."order" 
 		WHERE "id" = $1`,
 		id,
-	).Scan(&order.ID, &order.Product, &order.Price, &order.UserID, &order.CreatedAt)
+	).Scan(&order.ID, &order.Product, &order.Price.Amount, &order.Price.Currency, &order.UserID, &order.Status, &order.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
+	if err := r.loadItems(ctx, []*model.Order{&order}); err != nil {
+		return nil, err
+	}
 	return &order, nil
 }
+
+// ListOrders returns orders newest first, paginated by page and page size
+func (r *OrderSqlRepositoryImpl) ListOrders(ctx context.Context, filter model.OrderFilter) ([]*model.Order, int64, error) {
+	filter.Normalize()
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.UserID != 0 {
+		add(`"userId" = $%d`, filter.UserID)
+	}
+	if filter.CreatedFrom != nil {
+		add(`"createdAt" >= $%d`, *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add(`"createdAt" < $%d`, *filter.CreatedTo)
+	}
+	if filter.Currency != "" {
+		add(`"priceCurrency" = $%d`, filter.Currency)
+	}
+	if filter.MinPrice != nil {
+		add(`"priceAmount" >= $%d`, *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		add(`"priceAmount" <= $%d`, *filter.MaxPrice)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int64
+	if err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM public."order"`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.PageSize, filter.Offset())
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT "id", "product", "priceAmount", "priceCurrency", "userId", "status", "createdAt" FROM public."order"`+where+
+			fmt.Sprintf(` ORDER BY "createdAt" DESC, "id" DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := r.loadItems(ctx, orders); err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+// CreateOrder inserts the order and its items in one transaction
+func (r *OrderSqlRepositoryImpl) CreateOrder(ctx context.Context, order *model.Order) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO public."order" ("product", "priceAmount", "priceCurrency", "userId", "status")
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING "id", "createdAt"`,
+			order.Product, order.Price.Amount, order.Price.Currency, order.UserID, order.Status,
+		).Scan(&order.ID, &order.CreatedAt)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+			r.Log.WarnContext(ctx, "order references an unknown user", "user_id", order.UserID)
+			return model.ErrUnknownUser
+		}
+		if err != nil {
+			return err
+		}
+		return insertItems(ctx, tx, order.ID, order.Items)
+	})
+}
+
+// ReplaceOrderItems deletes the order's items and inserts the given ones in one transaction
+func (r *OrderSqlRepositoryImpl) ReplaceOrderItems(ctx context.Context, orderID int64, items []model.OrderItem) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM public."order_item" WHERE "orderId" = $1`, orderID); err != nil {
+			return err
+		}
+		return insertItems(ctx, tx, orderID, items)
+	})
+}
+
+func (r *OrderSqlRepositoryImpl) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertItems(ctx context.Context, tx *sql.Tx, orderID int64, items []model.OrderItem) error {
+	for i := range items {
+		items[i].OrderID = orderID
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO public."order_item" ("orderId", "productId", "name", "quantity", "priceAmount", "priceCurrency")
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING "id"`,
+			orderID, items[i].ProductID, items[i].Name, items[i].Quantity, items[i].Price.Amount, items[i].Price.Currency,
+		).Scan(&items[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadItems fetches the items of all given orders with a single query
+func (r *OrderSqlRepositoryImpl) loadItems(ctx context.Context, orders []*model.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*model.Order, len(orders))
+	ids := make([]int64, 0, len(orders))
+	for _, o := range orders {
+		o.Items = []model.OrderItem{}
+		byID[o.ID] = o
+		ids = append(ids, o.ID)
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT "id", "orderId", "productId", "name", "quantity", "priceAmount", "priceCurrency"
+		FROM public."order_item" WHERE "orderId" = ANY($1) ORDER BY "id"`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item model.OrderItem
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Name, &item.Quantity, &item.Price.Amount, &item.Price.Currency); err != nil {
+			return err
+		}
+		if o, ok := byID[item.OrderID]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *OrderSqlRepositoryImpl) UpdateOrder(ctx context.Context, order *model.Order) error {
+	res, err := r.DB.ExecContext(ctx,
+		`UPDATE public."order" SET "product"=$1, "priceAmount"=$2, "priceCurrency"=$3 WHERE "id"=$4 AND "status"=$5`,
+		order.Product, order.Price.Amount, order.Price.Currency, order.ID, model.OrderStatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		r.Log.InfoContext(ctx, "order not updated, it is missing or no longer pending", "order_id", order.ID)
+		return model.ErrOrderNotFound
+	}
+	return nil
+}
+
+func (r *OrderSqlRepositoryImpl) UpdateOrderStatus(ctx context.Context, id int64, from, to string) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE public."order" SET "status"=$1 WHERE "id"=$2 AND "status"=$3`, to, id, from)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		r.Log.InfoContext(ctx, "order status not changed, it is missing or no longer "+from, "order_id", id, "to", to)
+		return model.ErrOrderNotFound
+	}
+	return nil
+}
+
+func (r *OrderSqlRepositoryImpl) AddStatusHistory(ctx context.Context, entry *model.OrderStatusHistory) error {
+	return r.DB.QueryRowContext(ctx,
+		`INSERT INTO public."order_status_history" ("orderId", "fromStatus", "toStatus", "actorId", "changedAt")
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING "id"`,
+		entry.OrderID, entry.FromStatus, entry.ToStatus, entry.ActorID, entry.ChangedAt,
+	).Scan(&entry.ID)
+}
+
+func (r *OrderSqlRepositoryImpl) GetStatusHistory(ctx context.Context, orderID int64) ([]*model.OrderStatusHistory, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT "id", "orderId", "fromStatus", "toStatus", "actorId", "changedAt"
+		FROM public."order_status_history" WHERE "orderId" = $1 ORDER BY "changedAt", "id"`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*model.OrderStatusHistory
+	for rows.Next() {
+		var h model.OrderStatusHistory
+		if err := rows.Scan(&h.ID, &h.OrderID, &h.FromStatus, &h.ToStatus, &h.ActorID, &h.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func scanOrders(rows *sql.Rows) ([]*model.Order, error) {
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		if err := rows.Scan(&order.ID, &order.Product, &order.Price.Amount, &order.Price.Currency, &order.UserID, &order.Status, &order.CreatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
@@ -1,22 +1,310 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	auditModel "go-template/internal/audit/model"
+	"go-template/internal/common/apperr"
+	"go-template/internal/db"
 	"go-template/internal/order/model"
 	"go-template/internal/order/repository"
+	outboxModel "go-template/internal/outbox/model"
+	"go-template/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go-template/internal/order/service")
+
+var (
+	ErrOrderNotEditable   = apperr.Conflict("order_not_editable", "order can only be changed while pending")
+	ErrInvalidOrderStatus = apperr.Validation("invalid_order_status", "unknown order status")
+	ErrOrderStatusChanged = apperr.Conflict("order_status_changed", "order status was changed concurrently, reload and retry")
+	// ErrInvalidTransition is returned, with the statuses in its message, when
+	// the order lifecycle does not allow a status change
+	ErrInvalidTransition = apperr.Conflict("invalid_status_transition", "order status change is not allowed")
 )
 
 type OrderService struct {
-	Repo repository.OrderRepository
+	Repo      repository.OrderRepository
+	txManager db.TransactionManager
+	log       *slog.Logger
+}
+
+// Authorizer checks that the caller may act on an order once it has been
+// loaded, so the order is read only once. A nil Authorizer allows every order.
+type Authorizer func(order *model.Order) error
+
+func (a Authorizer) check(order *model.Order) error {
+	if a == nil {
+		return nil
+	}
+	return a(order)
+}
+
+// OrderUpdate holds the order fields a client may change; nil fields are left as is.
+// Setting Items replaces all line items and recalculates the price.
+type OrderUpdate struct {
+	Product *string
+	Items   *[]model.OrderItem
+}
+
+func NewOrderService(repo repository.OrderRepository, logger *slog.Logger) *OrderService {
+	return &OrderService{Repo: repo, log: logger}
+}
+
+func NewOrderServiceWithTx(repo repository.OrderRepository, txManager db.TransactionManager, logger *slog.Logger) *OrderService {
+	return &OrderService{
+		Repo:      repo,
+		txManager: txManager,
+		log:       logger,
+	}
+}
+
+// GetOrderByID returns an order or model.ErrOrderNotFound
+func (s *OrderService) GetOrderByID(ctx context.Context, id int64) (_ *model.Order, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.GetOrderByID", trace.WithAttributes(attribute.Int64("order.id", id)))
+	defer func() { tracing.End(span, err) }()
+	order, err := s.Repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, model.ErrOrderNotFound
+	}
+	return order, nil
 }
 
-func NewOrderService(repo repository.OrderRepository) *OrderService {
-	return &OrderService{Repo: repo}
+// ListOrders returns one page of orders matching the filter and the total number of matches
+func (s *OrderService) ListOrders(ctx context.Context, filter model.OrderFilter) (_ []*model.Order, _ int64, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.ListOrders")
+	defer func() { tracing.End(span, err) }()
+	return s.Repo.ListOrders(ctx, filter)
+}
+
+// CreateOrder stores a new pending order and its items in one transaction.
+// The price is derived from the items and actorID is recorded in the status history.
+func (s *OrderService) CreateOrder(ctx context.Context, order *model.Order, actorID int64) (err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.CreateOrder")
+	defer func() { tracing.End(span, err) }()
+	if err := order.PrepareItems(); err != nil {
+		return err
+	}
+	order.Status = model.OrderStatusPending
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	if err := CreateOrderInTx(ctx, uow, order, actorID); err != nil {
+		return err
+	}
+	return uow.Commit()
+}
+
+// CreateOrderInTx writes a prepared order, its items, its initial status
+// history entry and its audit entry within an existing unit of work
+func CreateOrderInTx(ctx context.Context, uow db.UnitOfWork, order *model.Order, actorID int64) error {
+	if err := uow.OrderRepo().CreateOrder(ctx, order); err != nil {
+		return err
+	}
+	if err := uow.OrderRepo().AddStatusHistory(ctx, &model.OrderStatusHistory{
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ActorID:   actorID,
+		ChangedAt: order.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if err := recordOrder(ctx, uow, auditModel.ActionCreate, order.ID, nil, auditModel.Snapshot(order)); err != nil {
+		return err
+	}
+	return addEvent(ctx, uow, outboxModel.TypeOrderCreated, order.ID, outboxModel.OrderCreated{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Product:   order.Product,
+		Price:     order.Price,
+		Status:    order.Status,
+		Items:     len(order.Items),
+		CreatedAt: order.CreatedAt,
+	})
+}
+
+// recordOrder writes the audit entry of an order change on the change's unit of work
+func recordOrder(ctx context.Context, uow db.UnitOfWork, action string, id int64, before, after map[string]any) error {
+	return uow.AuditRepo().Record(ctx, auditModel.NewEntry(ctx, action, auditModel.EntityOrder, id, before, after))
+}
+
+// addEvent stores a domain event on the unit of work; the relay publishes it
+// once the change has committed
+func addEvent(ctx context.Context, uow db.UnitOfWork, eventType string, id int64, payload any) error {
+	event, err := outboxModel.NewEvent(ctx, eventType, id, payload)
+	if err != nil {
+		return err
+	}
+	return uow.OutboxRepo().Add(ctx, event)
+}
+
+// UpdateOrder applies a partial update to a pending order the caller may update
+func (s *OrderService) UpdateOrder(ctx context.Context, id int64, update OrderUpdate, authorize Authorizer) (_ *model.Order, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.UpdateOrder", trace.WithAttributes(attribute.Int64("order.id", id)))
+	defer func() { tracing.End(span, err) }()
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	repo := uow.OrderRepo()
+	order, err := repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, model.ErrOrderNotFound
+	}
+	if err := authorize.check(order); err != nil {
+		return nil, err
+	}
+	if order.Status != model.OrderStatusPending {
+		return nil, ErrOrderNotEditable
+	}
+	before := auditModel.Snapshot(order)
+	if update.Product != nil {
+		order.Product = *update.Product
+	}
+	if update.Items != nil {
+		order.Items = *update.Items
+		if err := order.PrepareItems(); err != nil {
+			return nil, err
+		}
+	}
+	// The update only matches while the order is still pending, so a status
+	// change committed since the read above is not overwritten
+	if err := repo.UpdateOrder(ctx, order); err != nil {
+		if errors.Is(err, model.ErrOrderNotFound) {
+			return nil, ErrOrderNotEditable
+		}
+		return nil, err
+	}
+	if update.Items != nil {
+		if err := repo.ReplaceOrderItems(ctx, order.ID, order.Items); err != nil {
+			return nil, err
+		}
+	}
+	if err := recordOrder(ctx, uow, auditModel.ActionUpdate, id, before, auditModel.Snapshot(order)); err != nil {
+		return nil, err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeOrderUpdated, id, outboxModel.OrderUpdated{
+		OrderID: id,
+		Product: order.Product,
+		Price:   order.Price,
+		Items:   len(order.Items),
+	}); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ChangeStatus moves an order to a new status if the lifecycle allows it and
+// records the change, with the acting user, in the status history
+func (s *OrderService) ChangeStatus(ctx context.Context, id int64, to string, actorID int64, authorize Authorizer) (_ *model.Order, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.ChangeStatus", trace.WithAttributes(attribute.Int64("order.id", id)))
+	defer func() { tracing.End(span, err) }()
+	if !model.IsValidOrderStatus(to) {
+		return nil, ErrInvalidOrderStatus
+	}
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	repo := uow.OrderRepo()
+	order, err := repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, model.ErrOrderNotFound
+	}
+	if err := authorize.check(order); err != nil {
+		return nil, err
+	}
+	from := order.Status
+	if !model.CanTransition(from, to) {
+		return nil, ErrInvalidTransition.WithMessage("cannot change order status from %s to %s", from, to)
+	}
+	// The update only matches while the order is still in the status we checked
+	if err := repo.UpdateOrderStatus(ctx, id, from, to); err != nil {
+		if errors.Is(err, model.ErrOrderNotFound) {
+			return nil, ErrOrderStatusChanged
+		}
+		return nil, err
+	}
+	if err := repo.AddStatusHistory(ctx, &model.OrderStatusHistory{
+		OrderID:    id,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		ChangedAt:  time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	if err := recordOrder(ctx, uow, auditModel.ActionChangeStatus, id,
+		map[string]any{"status": from}, map[string]any{"status": to}); err != nil {
+		return nil, err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeOrderStatusChanged, id, outboxModel.OrderStatusChanged{
+		OrderID: id,
+		UserID:  order.UserID,
+		From:    from,
+		To:      to,
+		ActorID: actorID,
+	}); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "order status changed", "order_id", id, "from", from, "to", to, "actor_id", actorID)
+	order.Status = to
+	return order, nil
 }
 
-func (s *OrderService) GetOrderByID(id int64) (*model.Order, error) {
-	return s.Repo.GetOrderByID(id)
+// CancelOrder cancels an order that has not been fulfilled yet
+func (s *OrderService) CancelOrder(ctx context.Context, id int64, actorID int64, authorize Authorizer) (_ *model.Order, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.CancelOrder", trace.WithAttributes(attribute.Int64("order.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return s.ChangeStatus(ctx, id, model.OrderStatusCancelled, actorID, authorize)
 }
 
-func (s *OrderService) CreateOrder(order *model.Order) error {
-	return s.Repo.CreateOrder(order)
+// GetStatusHistory returns the status changes of an order the caller may read, oldest first
+func (s *OrderService) GetStatusHistory(ctx context.Context, id int64, authorize Authorizer) (_ []*model.OrderStatusHistory, err error) {
+	ctx, span := tracer.Start(ctx, "OrderService.GetStatusHistory", trace.WithAttributes(attribute.Int64("order.id", id)))
+	defer func() { tracing.End(span, err) }()
+	order, err := s.Repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, model.ErrOrderNotFound
+	}
+	if err := authorize.check(order); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetStatusHistory(ctx, id)
 }
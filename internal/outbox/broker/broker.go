@@ -0,0 +1,114 @@
+// Package broker delivers the domain events published by the outbox relay.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-template/internal/outbox/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Broker publishes events to their consumers. Publish may be called again for
+// an event it already delivered (the relay delivers at least once), so
+// consumers must ignore event ids they have seen.
+type Broker interface {
+	Publish(ctx context.Context, event *model.Event) error
+}
+
+// RedisStreamBroker appends events to Redis Streams, one stream per aggregate
+// named <stream>:<aggregate> (e.g. events:user). Consumers read them with
+// XREAD or consumer groups (XREADGROUP).
+type RedisStreamBroker struct {
+	Rdb    *redis.Client
+	Stream string
+	// MaxLen approximately caps each stream; 0 keeps every entry
+	MaxLen int64
+}
+
+func NewRedisStreamBroker(rdb *redis.Client, stream string, maxLen int64) Broker {
+	return &RedisStreamBroker{Rdb: rdb, Stream: stream, MaxLen: maxLen}
+}
+
+func (b *RedisStreamBroker) Publish(ctx context.Context, event *model.Event) error {
+	args := &redis.XAddArgs{
+		Stream: b.Stream + ":" + event.Aggregate,
+		Values: map[string]interface{}{
+			"id":          event.EventID,
+			"type":        event.Type,
+			"aggregateId": strconv.FormatInt(event.AggregateID, 10),
+			"occurredAt":  event.OccurredAt.UTC().Format(time.RFC3339Nano),
+			"requestId":   event.RequestID,
+			"payload":     string(event.Payload),
+		},
+	}
+	if b.MaxLen > 0 {
+		args.MaxLen = b.MaxLen
+		args.Approx = true
+	}
+	return b.Rdb.XAdd(ctx, args).Err()
+}
+
+// ErrNoSubscribers is returned by MemoryBroker.Publish for an event no handler
+// is subscribed to, so the relay retries it instead of dropping it
+var ErrNoSubscribers = errors.New("no subscribers")
+
+// Handler consumes an event. Returning an error fails the delivery, and the
+// relay retries the event later with every handler.
+type Handler func(ctx context.Context, event *model.Event) error
+
+// MemoryBroker delivers events to handlers in the same process, synchronously
+// and in subscription order. Useful for single instances and tests.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: map[string][]Handler{}}
+}
+
+// Subscribe registers h for events of the given type, or for every event with "*"
+func (b *MemoryBroker) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// HasSubscribers reports whether any handler is subscribed
+func (b *MemoryBroker) HasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.handlers) > 0
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event *model.Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[event.Type]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+	if len(handlers) == 0 {
+		return fmt.Errorf("%s: %w", event.Type, ErrNoSubscribers)
+	}
+	for _, h := range handlers {
+		if err := h(ctx, event); err != nil {
+			return fmt.Errorf("%s handler failed: %w", event.Type, err)
+		}
+	}
+	return nil
+}
+
+// LogHandler logs every event it receives. Subscribed with "*", it keeps the
+// events of a memory broker visible until real consumers are added.
+func LogHandler(logger *slog.Logger) Handler {
+	return func(ctx context.Context, event *model.Event) error {
+		logger.InfoContext(ctx, "domain event", "event_id", event.EventID, "type", event.Type,
+			"aggregate", event.Aggregate, "aggregate_id", event.AggregateID)
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-template/internal/logging"
+)
+
+// Delivery states of an outbox event
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+	// StatusDead marks an event that failed every publishing attempt. It stays
+	// in the outbox with its last error until it is requeued by hand.
+	StatusDead = "dead"
+)
+
+// TableName sets the table name for GORM to 'outbox'
+func (Event) TableName() string {
+	return "outbox"
+}
+
+// Event is a domain event stored in the outbox table. It is written on the
+// unit of work of the change it describes and published later by the relay.
+type Event struct {
+	ID int64 `json:"-"`
+	// EventID is unique per event; consumers use it to drop redelivered events
+	EventID     string    `json:"id" gorm:"column:eventId"`
+	Type        string    `json:"type"`
+	Aggregate   string    `json:"aggregate"`
+	AggregateID int64     `json:"aggregateId" gorm:"column:aggregateId"`
+	Payload     Payload   `json:"payload" gorm:"type:jsonb"`
+	RequestID   string    `json:"requestId,omitempty" gorm:"column:requestId"`
+	OccurredAt  time.Time `json:"occurredAt" gorm:"column:occurredAt"`
+
+	Status        string     `json:"-"`
+	Attempts      int        `json:"-"`
+	NextAttemptAt time.Time  `json:"-" gorm:"column:nextAttemptAt"`
+	LastError     string     `json:"-" gorm:"column:lastError"`
+	PublishedAt   *time.Time `json:"-" gorm:"column:publishedAt"`
+}
+
+// Payload is the JSON body of an event
+type Payload json.RawMessage
+
+func (p Payload) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "{}", nil
+	}
+	return string(p), nil
+}
+
+func (p *Payload) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		*p = append(Payload(nil), v...)
+		return nil
+	case string:
+		*p = Payload(v)
+		return nil
+	}
+	return errors.New("outbox: unsupported payload value")
+}
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+func (p *Payload) UnmarshalJSON(b []byte) error {
+	*p = append((*p)[:0], b...)
+	return nil
+}
+
+// NewEvent creates a pending event of the given type for an aggregate. The
+// aggregate is the part of the type before the dot (e.g. "user" for
+// "user.registered") and the request id is taken from ctx.
+func NewEvent(ctx context.Context, eventType string, aggregateID int64, payload any) (*Event, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", eventType, err)
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	aggregate, _, _ := strings.Cut(eventType, ".")
+	now := time.Now()
+	return &Event{
+		EventID:       id,
+		Type:          eventType,
+		Aggregate:     aggregate,
+		AggregateID:   aggregateID,
+		Payload:       body,
+		RequestID:     logging.RequestID(ctx),
+		OccurredAt:    now,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// Decode unmarshals the payload into v, e.g. a *UserRegistered
+func (e *Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// MarkPublished records a successful delivery
+func (e *Event) MarkPublished(at time.Time) {
+	e.Status = StatusPublished
+	e.Attempts++
+	e.LastError = ""
+	e.PublishedAt = &at
+}
+
+// MarkFailed records a failed delivery. The event is retried at retryAt, or
+// dead-lettered when it has used up maxAttempts.
+func (e *Event) MarkFailed(err error, retryAt time.Time, maxAttempts int) {
+	e.Attempts++
+	e.LastError = err.Error()
+	if e.Attempts >= maxAttempts {
+		e.Status = StatusDead
+		return
+	}
+	e.NextAttemptAt = retryAt
+}
+
+// randomID returns a random hex identifier for EventID
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate event id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"time"
+
+	"go-template/pkg/money"
+)
+
+// Event types. The payload of each type is the struct of the same name.
+const (
+	TypeUserRegistered     = "user.registered"
+	TypeUserUpdated        = "user.updated"
+	TypeUserRoleChanged    = "user.role_changed"
+	TypeUserDeleted        = "user.deleted"
+	TypeUserRestored       = "user.restored"
+	TypeUserPurged         = "user.purged"
+	TypeOrderCreated       = "order.created"
+	TypeOrderUpdated       = "order.updated"
+	TypeOrderStatusChanged = "order.status_changed"
+	TypeOrderPurged        = "order.purged"
+)
+
+type UserRegistered struct {
+	UserID    int64     `json:"userId"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type UserUpdated struct {
+	UserID int64  `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+type UserRoleChanged struct {
+	UserID int64  `json:"userId"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+type UserDeleted struct {
+	UserID int64 `json:"userId"`
+}
+
+type UserRestored struct {
+	UserID int64 `json:"userId"`
+}
+
+// UserPurged is published when a deleted user is removed for good, with
+// their orders if OrdersPurged is set
+type UserPurged struct {
+	UserID       int64 `json:"userId"`
+	OrdersPurged bool  `json:"ordersPurged"`
+}
+
+type OrderCreated struct {
+	OrderID   int64       `json:"orderId"`
+	UserID    int64       `json:"userId"`
+	Product   string      `json:"product"`
+	Price     money.Money `json:"price"`
+	Status    string      `json:"status"`
+	Items     int         `json:"items"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+type OrderUpdated struct {
+	OrderID int64       `json:"orderId"`
+	Product string      `json:"product"`
+	Price   money.Money `json:"price"`
+	Items   int         `json:"items"`
+}
+
+type OrderStatusChanged struct {
+	OrderID int64  `json:"orderId"`
+	UserID  int64  `json:"userId"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	ActorID int64  `json:"actorId"`
+}
+
+// OrderPurged is published for each order removed with its purged user
+// under the cascade policy
+type OrderPurged struct {
+	OrderID int64 `json:"orderId"`
+	UserID  int64 `json:"userId"`
+}
@@ -0,0 +1,243 @@
+// Package relay publishes the events stored in the outbox to a broker.
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go-template/internal/db"
+	"go-template/internal/metrics"
+	"go-template/internal/outbox/broker"
+	"go-template/internal/outbox/model"
+	"go-template/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go-template/internal/outbox/relay")
+
+const (
+	// publishTimeout bounds one Publish call
+	publishTimeout = 5 * time.Second
+	// cleanupInterval is how often published events past their retention are deleted
+	cleanupInterval = time.Hour
+)
+
+// Relay moves events from the outbox to the broker. Every event is published
+// at least once: an event whose delivery failed is retried with exponential
+// backoff and dead-lettered (status dead) after maxAttempts tries. Several
+// instances may relay at the same time, each claims different events.
+//
+// Events are claimed with a lease in a short transaction and published after
+// it has committed, so no row lock is held while the broker is called. If a
+// relay stops before recording the outcome, the events are published again
+// once their lease has run out.
+//
+// Events are claimed in id order, but ordering is not guaranteed: a retried
+// event is published after later events of the same aggregate, and relays of
+// different instances publish concurrently. Consumers that care about order
+// must compare the event's occurredAt, or re-read the aggregate.
+type Relay struct {
+	txManager   db.TransactionManager
+	broker      broker.Broker
+	log         *slog.Logger
+	batchSize   int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+}
+
+func New(txManager db.TransactionManager, b broker.Broker, logger *slog.Logger) *Relay {
+	return &Relay{
+		txManager:   txManager,
+		broker:      b,
+		log:         logger,
+		batchSize:   100,
+		maxAttempts: 10,
+		backoff:     time.Second,
+		maxBackoff:  5 * time.Minute,
+		retention:   7 * 24 * time.Hour,
+	}
+}
+
+// WithBatchSize sets how many events are claimed at once
+func (r *Relay) WithBatchSize(n int) *Relay {
+	r.batchSize = n
+	return r
+}
+
+// WithRetry sets how often an event is tried before it is dead-lettered and
+// the delay after the first failure, which doubles with every further failure
+// up to maxBackoff
+func (r *Relay) WithRetry(maxAttempts int, backoff, maxBackoff time.Duration) *Relay {
+	r.maxAttempts = maxAttempts
+	r.backoff = backoff
+	r.maxBackoff = maxBackoff
+	return r
+}
+
+// WithRetention sets how long published events are kept; 0 keeps them forever
+func (r *Relay) WithRetention(retention time.Duration) *Relay {
+	r.retention = retention
+	return r
+}
+
+// RelayBatch publishes one batch of due events and returns how many were claimed
+func (r *Relay) RelayBatch(ctx context.Context) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "Relay.RelayBatch")
+	defer func() { tracing.End(span, err) }()
+	events, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int("outbox.events", len(events)))
+	for _, event := range events {
+		r.publish(ctx, event)
+	}
+	// Record the outcome even when ctx was cancelled while publishing,
+	// otherwise the events would be published again after the lease
+	if err := r.saveDeliveries(context.WithoutCancel(ctx), events); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// lease is how long claimed events are reserved, long enough to try every
+// event of a full batch
+func (r *Relay) lease() time.Duration {
+	return time.Duration(r.batchSize+1) * publishTimeout
+}
+
+// claim leases a batch of due events and commits right away
+func (r *Relay) claim(ctx context.Context) ([]*model.Event, error) {
+	uow, err := r.txManager.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	now := time.Now()
+	events, err := uow.OutboxRepo().ClaimDue(ctx, now, now.Add(r.lease()), r.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// saveDeliveries stores the delivery state of the published events
+func (r *Relay) saveDeliveries(ctx context.Context, events []*model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	uow, err := r.txManager.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	for _, event := range events {
+		if err := uow.OutboxRepo().UpdateDelivery(ctx, event); err != nil {
+			return err
+		}
+	}
+	return uow.Commit()
+}
+
+// publish tries to deliver one event and records the outcome on it
+func (r *Relay) publish(ctx context.Context, event *model.Event) {
+	ctx, span := tracer.Start(ctx, "Relay.publish", trace.WithAttributes(
+		attribute.String("event.type", event.Type),
+		attribute.String("event.id", event.EventID),
+	))
+	pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	err := r.broker.Publish(pubCtx, event)
+	cancel()
+	tracing.End(span, err)
+
+	now := time.Now()
+	if err == nil {
+		event.MarkPublished(now)
+		metrics.OutboxEvent(metrics.OutboxPublished)
+		return
+	}
+	event.MarkFailed(err, now.Add(r.retryDelay(event.Attempts+1)), r.maxAttempts)
+	if event.Status == model.StatusDead {
+		metrics.OutboxEvent(metrics.OutboxDead)
+		r.log.ErrorContext(ctx, "event dead-lettered", "event_id", event.EventID, "type", event.Type,
+			"attempts", event.Attempts, "error", err)
+		return
+	}
+	metrics.OutboxEvent(metrics.OutboxRetry)
+	r.log.WarnContext(ctx, "publishing event failed, will retry", "event_id", event.EventID, "type", event.Type,
+		"attempts", event.Attempts, "retry_at", event.NextAttemptAt, "error", err)
+}
+
+// retryDelay is the wait after the given failed attempt: backoff doubled for
+// every earlier failure, capped at maxBackoff
+func (r *Relay) retryDelay(attempt int) time.Duration {
+	delay := r.backoff
+	for i := 1; i < attempt && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.maxBackoff)
+}
+
+// DeletePublished removes events published longer than the retention ago
+func (r *Relay) DeletePublished(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "Relay.DeletePublished")
+	defer func() { tracing.End(span, err) }()
+	uow, err := r.txManager.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	deleted, err := uow.OutboxRepo().DeletePublished(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		return err
+	}
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+	if deleted > 0 {
+		r.log.InfoContext(ctx, "published events deleted", "count", deleted)
+	}
+	return nil
+}
+
+// Run relays due events every interval until ctx is cancelled. Full batches
+// are followed by the next batch right away, so a backlog drains quickly.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.log.ErrorContext(ctx, "relaying events failed", "error", err)
+			}
+			if err != nil || n < r.batchSize {
+				break
+			}
+		}
+		if r.retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+			if err := r.DeletePublished(ctx); err != nil && ctx.Err() == nil {
+				r.log.ErrorContext(ctx, "deleting published events failed", "error", err)
+			}
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
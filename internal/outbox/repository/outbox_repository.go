@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go-template/internal/outbox/model"
+
+	"gorm.io/gorm"
+)
+
+// OutboxRepository stores domain events until the relay has published them.
+// Add must run on the unit of work of the change, so an event is stored if
+// and only if the change is committed.
+type OutboxRepository interface {
+	Add(ctx context.Context, event *model.Event) error
+	// ClaimDue leases up to limit pending events due at now, oldest first, by
+	// moving their next attempt to leaseUntil. Once the claim is committed no
+	// other relay picks the events up before the lease ends, so they can be
+	// published outside the transaction. Events locked by another relay are
+	// skipped.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*model.Event, error)
+	// UpdateDelivery saves the delivery state of an event after an attempt
+	UpdateDelivery(ctx context.Context, event *model.Event) error
+	// DeletePublished removes events published before the given time and returns how many were removed
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type GormOutboxRepository struct {
+	DB *gorm.DB
+}
+
+// NewOutboxRepository returns an OutboxRepository implemented with GORM
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &GormOutboxRepository{DB: db}
+}
+
+func (r *GormOutboxRepository) Add(ctx context.Context, event *model.Event) error {
+	return r.DB.WithContext(ctx).Create(event).Error
+}
+
+// claimDueQuery moves the next attempt of the due events it locks to the end
+// of the lease and returns them
+const claimDueQuery = `UPDATE "outbox" SET "nextAttemptAt" = ?
+	WHERE "id" IN (
+		SELECT "id" FROM "outbox" WHERE "status" = ? AND "nextAttemptAt" <= ?
+		ORDER BY "id" LIMIT ? FOR UPDATE SKIP LOCKED)
+	RETURNING *`
+
+func (r *GormOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*model.Event, error) {
+	var events []*model.Event
+	err := r.DB.WithContext(ctx).Raw(claimDueQuery, leaseUntil, model.StatusPending, now, limit).Scan(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *GormOutboxRepository) UpdateDelivery(ctx context.Context, event *model.Event) error {
+	return r.DB.WithContext(ctx).Model(&model.Event{}).Where(`"id" = ?`, event.ID).Updates(map[string]interface{}{
+		"status":        event.Status,
+		"attempts":      event.Attempts,
+		"nextAttemptAt": event.NextAttemptAt,
+		"lastError":     event.LastError,
+		"publishedAt":   event.PublishedAt,
+	}).Error
+}
+
+func (r *GormOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.DB.WithContext(ctx).
+		Where(`"status" = ? AND "publishedAt" < ?`, model.StatusPublished, before).
+		Delete(&model.Event{})
+	return result.RowsAffected, result.Error
+}
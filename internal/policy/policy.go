@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OwnSuffix marks a permission that only applies to resources owned by the caller
+const OwnSuffix = ":own"
+
+// File is the on-disk policy format
+type File struct {
+	// Roles maps a role name to the permissions it grants
+	Roles map[string][]string `yaml:"roles"`
+}
+
+// Engine answers whether a role is granted a permission
+type Engine struct {
+	grants map[string]map[string]bool
+}
+
+// Load reads and parses a policy file
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return engine, nil
+}
+
+// Parse builds an Engine from YAML policy data
+func Parse(data []byte) (*Engine, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Roles) == 0 {
+		return nil, fmt.Errorf("policy defines no roles")
+	}
+	return New(f.Roles)
+}
+
+// New builds an Engine from a role → permissions map
+func New(roles map[string][]string) (*Engine, error) {
+	e := &Engine{grants: make(map[string]map[string]bool)}
+	for role, perms := range roles {
+		set := make(map[string]bool)
+		for _, p := range perms {
+			if p != "*" && !strings.Contains(p, ":") {
+				return nil, fmt.Errorf("role %q: invalid permission %q, expected resource:action", role, p)
+			}
+			set[p] = true
+		}
+		e.grants[role] = set
+	}
+	return e, nil
+}
+
+// HasRole reports whether the policy defines role
+func (e *Engine) HasRole(role string) bool {
+	_, ok := e.grants[role]
+	return ok
+}
+
+// Allows reports whether role is granted perm on any resource
+func (e *Engine) Allows(role, perm string) bool {
+	return e.has(role, perm)
+}
+
+// AllowsOwn reports whether role is granted perm on resources it owns.
+// A full grant implies the ownership-scoped one.
+func (e *Engine) AllowsOwn(role, perm string) bool {
+	return e.has(role, perm) || e.has(role, perm+OwnSuffix)
+}
+
+// Can reports whether a caller may perform perm on a resource owned by ownerID
+func (e *Engine) Can(role string, callerID int64, perm string, ownerID int64) bool {
+	if e.Allows(role, perm) {
+		return true
+	}
+	return ownerID != 0 && callerID == ownerID && e.AllowsOwn(role, perm)
+}
+
+func (e *Engine) has(role, perm string) bool {
+	set, ok := e.grants[role]
+	if !ok {
+		return false
+	}
+	if set["*"] || set[perm] {
+		return true
+	}
+	// "user:*" grants every action on user, "user:*:own" every owned action
+	resource, _, _ := strings.Cut(perm, ":")
+	if set[resource+":*"] {
+		return true
+	}
+	return strings.HasSuffix(perm, OwnSuffix) && set[resource+":*"+OwnSuffix]
+}
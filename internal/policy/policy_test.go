@@ -0,0 +1,101 @@
+package policy
+
+import "testing"
+
+const testPolicy = `
+roles:
+  admin:
+    - "*"
+  ops:
+    - order:read
+    - order:status
+  support:
+    - user:*
+  user:
+    - user:read:own
+    - order:*:own
+`
+
+func TestParseRejectsInvalidPolicies(t *testing.T) {
+	tests := map[string]string{
+		"invalid YAML":       "roles: [",
+		"no roles":           "roles: {}",
+		"missing action":     "roles:\n  user:\n    - user\n",
+		"roles not a map":    "roles:\n  - admin\n",
+		"permissions scalar": "roles:\n  user: user:read\n",
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse succeeded", name)
+		}
+	}
+}
+
+func TestShippedPolicyLoads(t *testing.T) {
+	e, err := Load("../../configs/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{"admin", "ops", "user"} {
+		if !e.HasRole(role) {
+			t.Errorf("shipped policy has no %q role", role)
+		}
+	}
+	// An owner may cancel their own order, even once it is paid
+	if !e.Can("user", 7, "order:cancel", 7) {
+		t.Error("user can not cancel their own order")
+	}
+}
+
+func TestCan(t *testing.T) {
+	e, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const caller, other = 7, 8
+	tests := []struct {
+		name    string
+		role    string
+		perm    string
+		ownerID int64
+		want    bool
+	}{
+		{"wildcard grants everything", "admin", "user:delete", other, true},
+		{"wildcard without an owner", "admin", "user:list", 0, true},
+		{"plain grant", "ops", "order:status", other, true},
+		{"plain grant needs no owner", "ops", "order:read", 0, true},
+		{"permission not granted", "ops", "order:update", other, false},
+		{"other resource not granted", "ops", "user:read", caller, false},
+		{"resource wildcard", "support", "user:restore", other, true},
+		{"resource wildcard is per resource", "support", "order:read", other, false},
+		{"own grant on own resource", "user", "user:read", caller, true},
+		{"own grant on another's resource", "user", "user:read", other, false},
+		{"own grant without an owner", "user", "user:read", 0, false},
+		{"own grant is per action", "user", "user:update", caller, false},
+		{"owned resource wildcard", "user", "order:cancel", caller, true},
+		{"owned resource wildcard on another's resource", "user", "order:cancel", other, false},
+		{"unknown role", "guest", "user:read", caller, false},
+		{"empty role", "", "user:read", caller, false},
+	}
+	for _, tt := range tests {
+		if got := e.Can(tt.role, caller, tt.perm, tt.ownerID); got != tt.want {
+			t.Errorf("%s: Can(%q, %d, %q, %d) = %v, want %v", tt.name, tt.role, caller, tt.perm, tt.ownerID, got, tt.want)
+		}
+	}
+}
+
+func TestAllowsOwn(t *testing.T) {
+	e, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.AllowsOwn("user", "user:read") || e.Allows("user", "user:read") {
+		t.Error("user:read:own must allow owned access only")
+	}
+	if !e.AllowsOwn("ops", "order:read") {
+		t.Error("a full grant must imply the owned one")
+	}
+	if e.AllowsOwn("guest", "user:read") || e.HasRole("guest") {
+		t.Error("an unknown role must not be granted anything")
+	}
+}
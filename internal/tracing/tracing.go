@@ -0,0 +1,18 @@
+// Package tracing holds small helpers for OpenTelemetry spans. The tracer
+// provider itself is set up in cmd/server.
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// End records err on the span, if any, and ends it. Use it with a named
+// error result: defer func() { tracing.End(span, err) }()
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
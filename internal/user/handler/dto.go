@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"time"
+
+	"go-template/internal/auth"
+	"go-template/internal/order/model"
+	userModel "go-template/internal/user/model"
+	"go-template/pkg/money"
+)
+
+// Request and response bodies of the user endpoints. Handlers never bind to or
+// serialize userModel.User directly, so credential fields can neither be set by
+// clients nor leave the API.
+
+// RegisterUserRequest is the body of a self-registration
+// swagger:model
+type RegisterUserRequest struct {
+	Name  string `json:"name" binding:"required,max=255" example:"Alice"`
+	Email string `json:"email" binding:"required,email,max=255" example:"alice@example.com"`
+	// 8 to 72 characters with at least one letter and one digit
+	Password string `json:"password" binding:"required,password" example:"s3cretpass"`
+}
+
+// CreateUserRequest is the body of an admin creating a user with any role
+// swagger:model
+type CreateUserRequest struct {
+	Name  string `json:"name" binding:"required,max=255" example:"Alice"`
+	Email string `json:"email" binding:"required,email,max=255" example:"alice@example.com"`
+	// 8 to 72 characters with at least one letter and one digit
+	Password string `json:"password" binding:"required,password" example:"s3cretpass"`
+	// A role defined in the policy file
+	Role string `json:"role" binding:"required" example:"user"`
+}
+
+// UpdateUserRequest is the body of PUT /user/{id}, replacing the user's profile.
+// The password and role can only be changed by their own endpoints.
+// swagger:model
+type UpdateUserRequest struct {
+	Name  string `json:"name" binding:"required,max=255" example:"Alice"`
+	Email string `json:"email" binding:"required,email,max=255" example:"alice@example.com"`
+}
+
+// PatchUserRequest is a JSON Merge Patch of PATCH /user/{id}; omitted fields
+// are left unchanged and any field not listed here is rejected
+// swagger:model
+type PatchUserRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitnil,min=1,max=255" example:"Alice"`
+	Email *string `json:"email,omitempty" binding:"omitnil,email,max=255" example:"alice@example.com"`
+}
+
+// ChangePasswordRequest is the body of PUT /user/{id}/password
+// swagger:model
+type ChangePasswordRequest struct {
+	// Required unless an administrator resets another user's password
+	OldPassword string `json:"old_password" example:"s3cretpass"`
+	// 8 to 72 characters with at least one letter and one digit
+	NewPassword string `json:"new_password" binding:"required,password" example:"n3wsecret"`
+}
+
+// ChangeRoleRequest is the body of PUT /user/{id}/role
+// swagger:model
+type ChangeRoleRequest struct {
+	// A role defined in the policy file
+	Role string `json:"role" binding:"required" example:"ops"`
+}
+
+// LoginRequest represents the login request body
+// swagger:model
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email" example:"abc@gmail.com"`
+	Password string `json:"password" binding:"required" example:"s3cretpass"`
+}
+
+// RefreshTokenRequest represents the refresh request body
+// swagger:model
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"3q2-7wT1m0Qe..."`
+}
+
+// TokenResponse represents the token pair returned by login and refresh
+// swagger:model
+type TokenResponse struct {
+	// Access token (JWT) to send as "Authorization: Bearer <token>"
+	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	// Opaque refresh token, valid for a single use
+	RefreshToken string `json:"refresh_token" example:"3q2-7wT1m0Qe..."`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	// Access token lifetime in seconds
+	ExpiresIn int64 `json:"expires_in" example:"900"`
+}
+
+func newTokenResponse(tokens *auth.TokenPair) TokenResponse {
+	return TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.AccessTokenExpiresAt).Seconds()),
+	}
+}
+
+// RegisterUserWithOrderRequest represents the request body for registering a user and creating an order
+// swagger:model RegisterUserWithOrderRequest
+type RegisterUserWithOrderRequest struct {
+	// User info
+	User RegisterUserWithOrderUser `json:"user"`
+	// Order info
+	Order RegisterUserWithOrderOrder `json:"order"`
+}
+
+// RegisterUserWithOrderUser represents user info for registration
+type RegisterUserWithOrderUser struct {
+	// User name
+	// example: testuser
+	Name string `json:"name" binding:"required,max=255"`
+	// User email
+	// example: test@example.com
+	Email string `json:"email" binding:"required,email,max=255"`
+	// User password, 8 to 72 characters with at least one letter and one digit
+	// example: s3cretpass
+	Password string `json:"password" binding:"required,password"`
+}
+
+// RegisterUserWithOrderOrder represents order info for registration
+type RegisterUserWithOrderOrder struct {
+	// Product
+	// example: "Laptop"
+	Product string `json:"product" binding:"required,max=255"`
+	// Price in minor units of its currency (e.g. cents), must be positive
+	Price money.Money `json:"price" binding:"money"`
+}
+
+// UserResponse is a user as returned by the API, without credentials
+// swagger:model
+type UserResponse struct {
+	ID        int       `json:"id" example:"1"`
+	Name      string    `json:"name" example:"Alice"`
+	Email     string    `json:"email" example:"alice@example.com"`
+	Role      string    `json:"role" example:"user"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Only set on soft-deleted users in admin listings
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// UserWithOrdersResponse is a user together with their orders
+// swagger:model
+type UserWithOrdersResponse struct {
+	User   UserResponse   `json:"user"`
+	Orders []*model.Order `json:"orders"`
+}
+
+// RegisterUserWithOrderResponse is the user and order created by POST /register_with_order
+// swagger:model
+type RegisterUserWithOrderResponse struct {
+	User  UserResponse `json:"user"`
+	Order *model.Order `json:"order"`
+}
+
+// UserListResponse is one page of users
+// swagger:model
+type UserListResponse struct {
+	Items []UserResponse `json:"items"`
+	// Pass as cursor to get the next page; absent on the last page
+	NextCursor string `json:"next_cursor,omitempty" example:"eyJzIjoiLWNyZWF0ZWRfYXQiLCJpZCI6NDJ9"`
+	// Only present when include_total=true
+	Total *int64 `json:"total,omitempty" example:"42"`
+}
+
+func newUserResponse(u *userModel.User) UserResponse {
+	resp := UserResponse{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt,
+	}
+	if u.DeletedAt.Valid {
+		resp.DeletedAt = &u.DeletedAt.Time
+	}
+	return resp
+}
+
+func newUserWithOrdersResponse(u *userModel.UserWithOrders) UserWithOrdersResponse {
+	orders := u.Orders
+	if orders == nil {
+		orders = []*model.Order{}
+	}
+	return UserWithOrdersResponse{User: newUserResponse(u.User), Orders: orders}
+}
+
+func newUserListResponse(page *userModel.UserPage) UserListResponse {
+	items := make([]UserResponse, 0, len(page.Users))
+	for _, u := range page.Users {
+		items = append(items, newUserResponse(u))
+	}
+	resp := UserListResponse{Items: items, Total: page.Total}
+	if page.Next != nil {
+		resp.NextCursor = page.Next.Encode()
+	}
+	return resp
+}
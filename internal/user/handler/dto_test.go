@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	orderModel "go-template/internal/order/model"
+	userModel "go-template/internal/user/model"
+
+	"gorm.io/gorm"
+)
+
+const passwordHash = "$2a$10$abcdefghijklmnopqrstuuC3M8v5zV0Jb6w8tW2pXn7y1QeYqXhS"
+
+func userWithPassword() *userModel.User {
+	return &userModel.User{
+		ID:        7,
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		Password:  passwordHash,
+		Role:      "user",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		DeletedAt: gorm.DeletedAt{Time: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+}
+
+// assertNoCredentials fails if the JSON of v contains the password hash or a
+// "password" key at any depth
+func assertNoCredentials(t *testing.T, v any) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(b), passwordHash) {
+		t.Errorf("password hash serialized: %s", b)
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if path, ok := findPasswordKey(decoded, "$"); ok {
+		t.Errorf("password key serialized at %s: %s", path, b)
+	}
+}
+
+func findPasswordKey(v any, path string) (string, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if strings.Contains(strings.ToLower(k), "password") {
+				return path + "." + k, true
+			}
+			if p, ok := findPasswordKey(child, path+"."+k); ok {
+				return p, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if p, ok := findPasswordKey(child, path+"[]"); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestResponsesNeverSerializeCredentials(t *testing.T) {
+	order := &orderModel.Order{ID: 3, UserID: 7, Product: "book", Status: orderModel.OrderStatusPending}
+	next := &userModel.UserCursor{Sort: "-created_at", ID: 7}
+	total := int64(1)
+
+	responses := map[string]any{
+		"model.User":                    userWithPassword(),
+		"UserResponse":                  newUserResponse(userWithPassword()),
+		"UserWithOrdersResponse":        newUserWithOrdersResponse(&userModel.UserWithOrders{User: userWithPassword(), Orders: []*orderModel.Order{order}}),
+		"RegisterUserWithOrderResponse": RegisterUserWithOrderResponse{User: newUserResponse(userWithPassword()), Order: order},
+		"UserListResponse":              newUserListResponse(&userModel.UserPage{Users: []*userModel.User{userWithPassword()}, Next: next, Total: &total}),
+	}
+	for name, resp := range responses {
+		t.Run(name, func(t *testing.T) {
+			assertNoCredentials(t, resp)
+		})
+	}
+}
+
+func TestUserResponseKeepsProfileFields(t *testing.T) {
+	resp := newUserResponse(userWithPassword())
+	if resp.ID != 7 || resp.Email != "alice@example.com" || resp.Role != "user" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.DeletedAt == nil {
+		t.Error("deletedAt of a soft-deleted user is missing")
+	}
+}
@@ -1,14 +1,36 @@
 package handler
 
-import "github.com/gin-gonic/gin"
+import (
+	"go-template/internal/middleware"
 
-func RegisterUserRoutes(r *gin.Engine) {
-	r.GET("/user/:id", GetUserHandler)
-	r.POST("/user", CreateUserHandler)
-	r.PUT("/user/:id", UpdateUserHandler)
-	r.DELETE("/user/:id", DeleteUserHandler)
-	r.POST("/register", RegisterUserHandler)
-	r.POST("/login", LoginHandler)
-	r.GET("/user/:id/orders", GetUserWithOrdersHandler)
+	"github.com/gin-gonic/gin"
+)
 
+func RegisterUserRoutes(r *gin.Engine, h *UserHandler) {
+	// Public routes
+	r.POST("/login", h.Login)
+	r.POST("/token/refresh", h.RefreshToken)
+	r.GET("/.well-known/jwks.json", h.JWKSHandler)
+	r.POST("/register", h.RegisterUser)
+	r.POST("/register_with_order", h.RegisterUserWithOrder)
+
+	// Protected routes, each guarded by a policy permission. ownUser lets a
+	// caller with an ":own" grant access the user record matching the :id param.
+	auth := h.guard.AuthMiddleware()
+	ownUser := middleware.OwnerFromParam("id")
+	r.POST("/logout", auth, h.Logout)
+	r.GET("/userwithcache/:id", auth, h.guard.RequirePermission("user:read", ownUser), h.GetUserWithCache)
+	r.GET("/users", auth, h.guard.RequirePermission("user:list"), h.ListUsers)
+	r.POST("/user", auth, h.guard.RequirePermission("user:create"), h.CreateUser)
+	authorized := r.Group("/user", auth)
+	{
+		authorized.GET("/:id", h.guard.RequirePermission("user:read", ownUser), h.GetUser)
+		authorized.PUT("/:id", h.guard.RequirePermission("user:update", ownUser), h.UpdateUser)
+		authorized.PATCH("/:id", h.guard.RequirePermission("user:update", ownUser), h.PatchUser)
+		authorized.PUT("/:id/password", h.guard.RequirePermission("user:password", ownUser), h.ChangePassword)
+		authorized.PUT("/:id/role", h.guard.RequirePermission("user:role"), h.ChangeRole)
+		authorized.DELETE("/:id", h.guard.RequirePermission("user:delete"), h.DeleteUser)
+		authorized.POST("/:id/restore", h.guard.RequirePermission("user:restore"), h.RestoreUser)
+		authorized.GET("/:id/orders", h.guard.RequirePermission("user:read", ownUser), h.guard.RequirePermission("order:read", ownUser), h.GetUserWithOrders)
+	}
 }
@@ -1,501 +1,540 @@
 package handler
 
 import (
-	"database/sql"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
-	"go-template/internal/common/commonmodel"
-	"go-template/internal/db"
+	"go-template/internal/auth"
+	"go-template/internal/common/apperr"
+	"go-template/internal/common/query"
+	"go-template/internal/middleware"
 	orderModel "go-template/internal/order/model"
-	orderrepo "go-template/internal/order/repository"
 	userModel "go-template/internal/user/model"
-	"go-template/internal/user/repository"
 	"go-template/internal/user/service"
+	"go-template/internal/validation"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
-// GetUserHandler godoc
+// UserService is the user business logic the handlers depend on
+type UserService interface {
+	GetUserByID(ctx context.Context, id int64) (*userModel.User, error)
+	GetUserByIDWithCache(ctx context.Context, id int64) (*userModel.User, error)
+	GetUserWithOrders(ctx context.Context, userID int64) (*userModel.UserWithOrders, error)
+	ListUsers(ctx context.Context, filter userModel.UserFilter) (*userModel.UserPage, error)
+	RegisterUser(ctx context.Context, user *userModel.User) error
+	RegisterUserWithOrder(ctx context.Context, user *userModel.User, order *orderModel.Order) error
+	UpdateUser(ctx context.Context, id int64, update service.UserUpdate) (*userModel.User, error)
+	ChangePassword(ctx context.Context, id int64, currentPassword, newPassword string) error
+	ResetPassword(ctx context.Context, id int64, newPassword string) error
+	ChangeRole(ctx context.Context, id int64, role string, actorID int64) (*userModel.User, error)
+	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) (*userModel.User, error)
+	LoginUser(ctx context.Context, email, password string) (*auth.TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenPair, error)
+	Logout(ctx context.Context, claims *auth.Claims) error
+	JWKS() auth.JWKS
+}
+
+var (
+	errInvalidUserID = apperr.Validation("invalid_user_id", "user id must be a valid integer")
+	errInvalidQuery  = apperr.Validation("invalid_query", "invalid query parameters")
+)
+
+// UserHandler serves the user, registration and token endpoints. Failures are
+// passed to the Errors middleware with c.Error.
+type UserHandler struct {
+	users UserService
+	guard *middleware.Guard
+	log   *slog.Logger
+}
+
+// NewUserHandler creates the user handlers; guard protects their routes.
+// Failures go to the Errors middleware; logger is for events worth a log
+// line on success.
+func NewUserHandler(users UserService, guard *middleware.Guard, logger *slog.Logger) *UserHandler {
+	return &UserHandler{users: users, guard: guard, log: logger}
+}
+
+func parseUserID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetUser godoc
 // @Summary Get user info
 // @Description Get user data by ID
 // @Tags user
 // @Security BearerAuth
 // @Param id path int true "User ID"
-// @Success 200 {object} model.User
+// @Success 200 {object} UserResponse
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
 // @Router /user/{id} [get]
-func GetUserHandler(c *gin.Context) {
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	userObj, err := h.users.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(userObj))
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List users with keyset pagination (admin only). Pass next_cursor from a response as cursor to get the next page, keeping the same sort and filters.
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Param role query string false "Filter by role"
+// @Param email query string false "Filter by part of the email address, case-insensitive"
+// @Param from query string false "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC 3339), or on or before a YYYY-MM-DD date"
+// @Param deleted query string false "Soft-deleted users: include or only (default: left out)" Enums(include, only)
+// @Param sort query string false "id, created_at, name or email; prefix with - for descending" default(-created_at)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param include_total query bool false "Also count all matching users"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /users [get]
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	page, err := h.users.ListUsers(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid user id",
-			Code:    http.StatusBadRequest,
-			Details: "User ID must be a valid integer",
-		})
-		return
-	}
-	jwtRole, _ := c.Get("role")
-	if jwtRole != "admin" {
-		c.JSON(http.StatusForbidden, commonmodel.ErrorResponse{
-			Error:   "Forbidden",
-			Code:    http.StatusForbidden,
-			Details: "You do not have permission to access this resource",
-		})
-		return
-	}
-	userObj, err := userService.GetUserByID(id)
-	if err == sql.ErrNoRows || userObj == nil {
-		c.JSON(http.StatusNotFound, commonmodel.ErrorResponse{
-			Error:   "User not found",
-			Code:    http.StatusNotFound,
-			Details: "No user found with the given ID",
-		})
-		return
-	} else if err != nil {
-		log.Printf("Query failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Internal server error",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, userObj)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserListResponse(page))
 }
 
-// CreateUserHandler godoc
+// CreateUser godoc
 // @Summary Create new user
 // @Description Add a new user
 // @Tags user
+// @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Param user body model.User true "User Info"
-// @Success 201 {object} map[string]interface{}
+// @Param user body CreateUserRequest true "User Info"
+// @Success 201 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
 // @Router /user [post]
-func CreateUserHandler(c *gin.Context) {
-	var user userModel.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid input",
-			Code:    http.StatusBadRequest,
-			Details: err.Error(),
-		})
-		return
-	}
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-	err := userService.RegisterUser(&user)
-	if err != nil {
-		log.Printf("Create failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Create failed",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	user := userModel.User{Name: req.Name, Email: req.Email, Password: req.Password, Role: req.Role}
+	if err := h.users.RegisterUser(c.Request.Context(), &user); err != nil {
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusCreated, user)
+	c.JSON(http.StatusCreated, newUserResponse(&user))
 }
 
-// UpdateUserHandler godoc
-// @Summary Edit user
-// @Description Edit user data by ID
+// UpdateUser godoc
+// @Summary Replace user profile
+// @Description Replace the name and email of a user. The password and role have their own endpoints.
 // @Tags user
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param user body model.User true "User Info"
-// @Success 200 {object} model.User
+// @Param user body UpdateUserRequest true "User Info"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
 // @Router /user/{id} [put]
-func UpdateUserHandler(c *gin.Context) {
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	var req UpdateUserRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	user, err := h.users.UpdateUser(c.Request.Context(), id, service.UserUpdate{Name: &req.Name, Email: &req.Email})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid user id",
-			Code:    http.StatusBadRequest,
-			Details: "User ID must be a valid integer",
-		})
-		return
-	}
-	var user userModel.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid input",
-			Code:    http.StatusBadRequest,
-			Details: err.Error(),
-		})
-		return
-	}
-	user.ID = int(id)
-	err = userService.UpdateUser(&user)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, commonmodel.ErrorResponse{
-			Error:   "User not found",
-			Code:    http.StatusNotFound,
-			Details: "No user found with the given ID",
-		})
-		return
-	} else if err != nil {
-		log.Printf("Update failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Update failed",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, user)
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
 }
 
-// DeleteUserHandler godoc
+// PatchUser godoc
+// @Summary Update user profile fields
+// @Description Apply a JSON Merge Patch (RFC 7396) to a user. Only name and email can be changed; other members, or null, are rejected.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body PatchUserRequest true "Fields to change"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
+// @Router /user/{id} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	var req PatchUserRequest
+	if err := validation.BindMergePatch(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	user, err := h.users.UpdateUser(c.Request.Context(), id, service.UserUpdate{Name: req.Name, Email: req.Email})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Replace a user's password. The current password must be given, unless the caller may update other users (user:update) and resets another user's password. Every session of the user is revoked afterwards, so they have to log in again.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Param id path int true "User ID"
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 204 {string} string ""
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors, a wrong current password is incorrect_password"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Router /user/{id}/password [put]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	var req ChangePasswordRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	principal, _ := middleware.CurrentPrincipal(c)
+	// An administrator resetting someone else's password does not know it
+	if principal.ID != id && h.guard.Authorize(c, "user:update", id) {
+		if err := h.users.ResetPassword(c.Request.Context(), id, req.NewPassword); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if req.OldPassword == "" {
+		c.Error(validation.ErrInvalidFields.WithFields(apperr.FieldError{
+			Field: "old_password", Code: "required", Message: "is required",
+		}))
+		return
+	}
+	if err := h.users.ChangePassword(c.Request.Context(), id, req.OldPassword, req.NewPassword); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ChangeRole godoc
+// @Summary Change user role
+// @Description Assign a policy role to a user (admin only). All of the user's sessions are logged out, so no token keeps the old role.
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body ChangeRoleRequest true "New role"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Router /user/{id}/role [put]
+func (h *UserHandler) ChangeRole(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	var req ChangeRoleRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	principal, _ := middleware.CurrentPrincipal(c)
+	user, err := h.users.ChangeRole(c.Request.Context(), id, req.Role, principal.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// DeleteUser godoc
 // @Summary Delete user
-// @Description Delete user by ID
+// @Description Soft delete a user and log out all of their sessions. The user can be restored until it is purged after the retention period. With the restrict orders policy, users who have orders can not be deleted (409 user_has_orders).
 // @Tags user
 // @Security BearerAuth
 // @Param id path int true "User ID"
 // @Success 204 {string} string ""
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 409 {object} commonmodel.Problem
 // @Router /user/{id} [delete]
-func DeleteUserHandler(c *gin.Context) {
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid user id",
-			Code:    http.StatusBadRequest,
-			Details: "User ID must be a valid integer",
-		})
-		return
-	}
-	err = userService.DeleteUser(id)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, commonmodel.ErrorResponse{
-			Error:   "User not found",
-			Code:    http.StatusNotFound,
-			Details: "No user found with the given ID",
-		})
-		return
-	} else if err != nil {
-		log.Printf("Delete failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Delete failed",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	if err := h.users.DeleteUser(c.Request.Context(), id); err != nil {
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
-// RegisterUserHandler godoc
+// RestoreUser godoc
+// @Summary Restore deleted user
+// @Description Undo the soft delete of a user that has not been purged yet (admin only)
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} UserResponse
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem "No deleted user with this id"
+// @Failure 409 {object} commonmodel.Problem "The email was registered again in the meantime"
+// @Router /user/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	user, err := h.users.RestoreUser(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// RegisterUser godoc
 // @Summary Register a new user
 // @Description Register a new user with name, email, and password
 // @Tags user
 // @Accept json
 // @Produce json
-// @Param user body model.User true "User Info"
-// @Success 201 {object} model.User
-// @Failure 400 {object} commonmodel.ErrorResponse
-// @Failure 500 {object} commonmodel.ErrorResponse
+// @Param user body RegisterUserRequest true "User Info"
+// @Success 201 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 409 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
 // @Router /register [post]
-func RegisterUserHandler(c *gin.Context) {
-	var user userModel.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid input",
-			Code:    http.StatusBadRequest,
-			Details: "Request body is not valid JSON or missing required fields",
-		})
-		return
-	}
-	if user.Name == "" || user.Email == "" || user.Password == "" {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Name, email, and password are required",
-			Code:    http.StatusBadRequest,
-			Details: "All fields are required for registration",
-		})
-		return
-	}
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Failed to hash password",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
-		return
-	}
-	db := c.MustGet("db").(*sql.DB)
-	err = db.QueryRow(`
-		INSERT INTO "user" ("name", "email", "password", "role")
-		VALUES ($1, $2, $3, $4)
-		RETURNING "id", "createdAt"
-	`, user.Name, user.Email, string(hashedPassword), "user").Scan(&user.ID, &user.CreatedAt)
-	if err != nil {
-		log.Printf("Register failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Register failed",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+func (h *UserHandler) RegisterUser(c *gin.Context) {
+	var req RegisterUserRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
-	user.Password = "" // Do not return password
-	c.JSON(http.StatusCreated, user)
-}
-
-// LoginRequest represents the login request body
-// swagger:model
-type LoginRequest struct {
-	Email    string `json:"email" example:"abc@gmail.com"`
-	Password string `json:"password" example:"1234"`
+	// Self-registration always creates a regular user
+	user := userModel.User{Name: req.Name, Email: req.Email, Password: req.Password, Role: "user"}
+	if err := h.users.RegisterUser(c.Request.Context(), &user); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, newUserResponse(&user))
 }
 
-// LoginHandler godoc
+// Login godoc
 // @Summary Login
-// @Description Login with email and password, returns JWT
+// @Description Login with email and password, returns a short-lived JWT access token and a refresh token
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param credentials body LoginRequest true "Login credentials"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} commonmodel.ErrorResponse
-// @Failure 401 {object} commonmodel.ErrorResponse
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 401 {object} commonmodel.Problem
 // @Router /login [post]
-// LoginHandler handles user login requests
+// Login handles user login requests
 // 1. Parse login credentials from JSON body
-// 2. Initialize repository and service layers
-// 3. Authenticate user and generate JWT token
-// 4. Return token or error response
-func LoginHandler(c *gin.Context) {
+// 2. Authenticate user and generate JWT token
+// 3. Return token or error response
+func (h *UserHandler) Login(c *gin.Context) {
 	// Parse login credentials from request body
 	var creds LoginRequest
-	if err := c.ShouldBindJSON(&creds); err != nil {
-		// If parsing fails, return 400 Bad Request
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid input",
-			Code:    http.StatusBadRequest,
-			Details: "Request body is not valid JSON or missing required fields",
-		})
-		return
-	}
-	// Get database connection from Gin context
-	db := c.MustGet("gorm").(*gorm.DB)
-	// Initialize user repository
-	repo := repository.NewUserRepository(db)
-	// Initialize order repository
-	orderRepo := orderrepo.NewOrderRepository(db)
-	// Initialize user service
-	userService := service.NewUserService(repo, orderRepo)
+	if err := validation.BindJSON(c, &creds); err != nil {
+		// If parsing or validation fails, return 400 Bad Request
+		c.Error(err)
+		return
+	}
 
 	// Authenticate user and generate JWT token
-	token, err := userService.LoginUser(creds.Email, creds.Password)
+	tokens, err := h.users.LoginUser(c.Request.Context(), creds.Email, creds.Password)
 	if err != nil {
-		// If authentication fails, return 401 Unauthorized
-		c.JSON(http.StatusUnauthorized, commonmodel.ErrorResponse{
-			Error:   "Unauthorized",
-			Code:    http.StatusUnauthorized,
-			Details: err.Error(),
-		})
+		// Wrong credentials are reported as 401 Unauthorized
+		c.Error(err)
+		return
+	}
+	// Return token pair in response
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new token pair. Each refresh token can be used once; reusing one revokes the whole session.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 401 {object} commonmodel.Problem
+// @Router /token/refresh [post]
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+	tokens, err := h.users.RefreshToken(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the current access token and every refresh token of its session
+// @Tags user
+// @Security BearerAuth
+// @Success 204 {string} string ""
+// @Failure 401 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
+// @Router /logout [post]
+func (h *UserHandler) Logout(c *gin.Context) {
+	claims, _ := middleware.CurrentClaims(c)
+	if err := h.users.Logout(c.Request.Context(), claims); err != nil {
+		c.Error(err)
 		return
 	}
-	// Return JWT token in response
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	h.log.InfoContext(c.Request.Context(), "user logged out", "user_id", claims.UserID, "session_id", claims.SessionID)
+	c.Status(http.StatusNoContent)
 }
 
-// GetUserWithOrdersHandler godoc
+// JWKSHandler godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by the token's kid header
+// @Tags user
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *UserHandler) JWKSHandler(c *gin.Context) {
+	// Keys are rotated by redeploying, so clients may cache the set briefly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.users.JWKS())
+}
+
+// GetUserWithOrders godoc
 // @Summary Get user info with orders
 // @Description Get user data and all orders by user ID
 // @Tags user
 // @Security BearerAuth
 // @Param id path int true "User ID"
-// @Success 200 {object} model.UserWithOrders
-// @Failure 400 {object} commonmodel.ErrorResponse
-// @Failure 404 {object} commonmodel.ErrorResponse
+// @Success 200 {object} UserWithOrdersResponse
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
 // @Router /user/{id}/orders [get]
-func GetUserWithOrdersHandler(c *gin.Context) {
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid user id",
-			Code:    http.StatusBadRequest,
-			Details: "User ID must be a valid integer",
-		})
+func (h *UserHandler) GetUserWithOrders(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
 		return
 	}
-	jwtRole, _ := c.Get("role")
-	if jwtRole != "admin" {
-		c.JSON(http.StatusForbidden, commonmodel.ErrorResponse{
-			Error:   "Forbidden",
-			Code:    http.StatusForbidden,
-			Details: "You do not have permission to access this resource",
-		})
-		return
-	}
-	result, err := userService.GetUserWithOrders(id)
+	result, err := h.users.GetUserWithOrders(c.Request.Context(), id)
 	if err != nil {
-		log.Printf("Query failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Internal server error",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+		c.Error(err)
 		return
 	}
-	if result == nil {
-		c.JSON(http.StatusNotFound, commonmodel.ErrorResponse{
-			Error:   "User not found",
-			Code:    http.StatusNotFound,
-			Details: "No user found with the given ID",
-		})
-		return
-	}
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, newUserWithOrdersResponse(result))
 }
 
-// GetUserWithCacheHandler godoc
+// GetUserWithCache godoc
 // @Summary Get user by ID with Redis caching
 // @Description Retrieve a user by ID. Uses Redis cache if available; falls back to DB otherwise.
 // @Tags user
+// @Security BearerAuth
 // @Param id path int true "User ID"
-// @Success 200 {object} model.User
-// @Failure 400 {object} commonmodel.ErrorResponse
-// @Failure 403 {object} commonmodel.ErrorResponse
-// @Failure 404 {object} commonmodel.ErrorResponse
-// @Failure 500 {object} commonmodel.ErrorResponse
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} commonmodel.Problem
+// @Failure 403 {object} commonmodel.Problem
+// @Failure 404 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
 // @Router /userwithcache/{id} [get]
-func GetUserWithCacheHandler(c *gin.Context) {
-	// Init repositories & services
-	db := c.MustGet("gorm").(*gorm.DB)
-	repo := repository.NewUserRepository(db)
-	orderRepo := orderrepo.NewOrderRepository(db)
-	userService := service.NewUserService(repo, orderRepo)
-
+func (h *UserHandler) GetUserWithCache(c *gin.Context) {
 	// Parse user ID
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid user id",
-			Code:    http.StatusBadRequest,
-			Details: "User ID must be a valid integer",
-		})
+	id, ok := parseUserID(c)
+	if !ok {
 		return
 	}
 
 	// Query user with cache support
-	result, err := userService.GetUserByIDWithCache(id)
+	result, err := h.users.GetUserByIDWithCache(c.Request.Context(), id)
 	if err != nil {
-		log.Printf("Query failed: %v", err)
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Internal server error",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+		c.Error(err)
 		return
 	}
-	if result == nil {
-		c.JSON(http.StatusNotFound, commonmodel.ErrorResponse{
-			Error:   "User not found",
-			Code:    http.StatusNotFound,
-			Details: "No user found with the given ID",
-		})
-		return
-	}
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, newUserResponse(result))
 }
 
-// RegisterUserWithOrderRequest represents the request body for registering a user and creating an order
-// swagger:model RegisterUserWithOrderRequest
-type RegisterUserWithOrderRequest struct {
-	// User info
-	User RegisterUserWithOrderUser `json:"user"`
-	// Order info
-	Order RegisterUserWithOrderOrder `json:"order"`
-}
-
-// RegisterUserWithOrderUser represents user info for registration
-type RegisterUserWithOrderUser struct {
-	// User name
-	// example: testuser
-	Name string `json:"name"`
-	// User email
-	// example: test@example.com
-	Email string `json:"email"`
-	// User password
-	// example: 123456
-	Password string `json:"password"`
-}
-
-// RegisterUserWithOrderOrder represents order info for registration
-type RegisterUserWithOrderOrder struct {
-	// Product
-	// example: "Laptop"
-	Product string `json:"product"`
-	// Price
-	// example: 100
-	Price int `json:"price"`
-}
-
-// RegisterUserWithOrderHandler godoc
+// RegisterUserWithOrder godoc
 // @Summary Register a new user and create an order (transactional)
 // @Description Register a new user and create an order in a single transaction
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param request body RegisterUserWithOrderRequest true "User and Order Info"
-// @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} commonmodel.ErrorResponse
-// @Failure 500 {object} commonmodel.ErrorResponse
+// @Success 201 {object} RegisterUserWithOrderResponse
+// @Failure 400 {object} commonmodel.Problem "Invalid fields are listed in errors"
+// @Failure 409 {object} commonmodel.Problem
+// @Failure 500 {object} commonmodel.Problem
 // @Router /register_with_order [post]
-func RegisterUserWithOrderHandler(c *gin.Context) {
+func (h *UserHandler) RegisterUserWithOrder(c *gin.Context) {
 	var req RegisterUserWithOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, commonmodel.ErrorResponse{
-			Error:   "Invalid input",
-			Code:    http.StatusBadRequest,
-			Details: err.Error(),
-		})
+	if err := validation.BindJSON(c, &req); err != nil {
+		c.Error(err)
 		return
 	}
-	// Get gorm.DB from context
-	gormDB := c.MustGet("gorm").(*gorm.DB)
-
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(gormDB)
-	orderRepo := orderrepo.NewOrderRepository(gormDB)
-
-	// Initialize TransactionManager (use package db, avoid variable name conflict)
-	txManager := db.NewTransactionManager(gormDB)
-
-	// Create Service (make sure the constructor is defined)
-	userService := service.NewUserServiceWithTx(userRepo, orderRepo, txManager)
 	// Convert request user to internal user model
 	user := &userModel.User{
 		Name:      req.User.Name,
@@ -504,19 +543,70 @@ func RegisterUserWithOrderHandler(c *gin.Context) {
 		Role:      "user",
 		CreatedAt: time.Now(),
 	}
+	// The order is a single line item; its price is derived from the item
 	order := &orderModel.Order{
-		Product:   req.Order.Product,
-		Price:     float64(req.Order.Price),
+		Product: req.Order.Product,
+		Items: []orderModel.OrderItem{{
+			Name:     req.Order.Product,
+			Quantity: 1,
+			Price:    req.Order.Price,
+		}},
 		CreatedAt: time.Now(),
 	}
-	err := userService.RegisterUserWithOrder(user, order)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, commonmodel.ErrorResponse{
-			Error:   "Register with order failed",
-			Code:    http.StatusInternalServerError,
-			Details: err.Error(),
-		})
+	if err := h.users.RegisterUserWithOrder(c.Request.Context(), user, order); err != nil {
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"user": user, "order": req.Order})
+	c.JSON(http.StatusCreated, RegisterUserWithOrderResponse{User: newUserResponse(user), Order: order})
+}
+
+// parseUserFilter reads the list filters from the query string
+func parseUserFilter(c *gin.Context) (userModel.UserFilter, error) {
+	f := userModel.UserFilter{
+		Role:  c.Query("role"),
+		Email: c.Query("email"),
+		Sort:  userModel.DefaultUserSort,
+	}
+	var err error
+	switch v := c.Query("deleted"); v {
+	case "", "include", "only":
+		f.Deleted = v
+	default:
+		return f, errInvalidQuery.WithMessage("deleted must be include or only")
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := query.ParseFrom(v)
+		if err != nil {
+			return f, errInvalidQuery.WithMessage("from: %s", err)
+		}
+		f.CreatedFrom = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := query.ParseTo(v)
+		if err != nil {
+			return f, errInvalidQuery.WithMessage("to: %s", err)
+		}
+		f.CreatedTo = &t
+	}
+	if v := c.Query("sort"); v != "" {
+		if f.Sort, err = userModel.ParseUserSort(v); err != nil {
+			return f, errInvalidQuery.WithMessage("%s", err)
+		}
+	}
+	if v := c.Query("cursor"); v != "" {
+		if f.After, err = userModel.DecodeUserCursor(v, f.Sort); err != nil {
+			return f, err
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, errInvalidQuery.WithMessage("limit must be an integer")
+		}
+	}
+	if v := c.Query("include_total"); v != "" {
+		if f.WithTotal, err = strconv.ParseBool(v); err != nil {
+			return f, errInvalidQuery.WithMessage("include_total must be true or false")
+		}
+	}
+	return f, nil
 }
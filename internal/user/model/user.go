@@ -1,8 +1,25 @@
 package model
 
 import (
-	"go-template/internal/order/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
+
+	"go-template/internal/common/apperr"
+	"go-template/internal/order/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound       = apperr.NotFound("user_not_found", "user not found")
+	ErrEmailTaken         = apperr.Conflict("email_taken", "email is already registered")
+	ErrUserHasOrders      = apperr.Conflict("user_has_orders", "user still has orders")
+	ErrInvalidCredentials = apperr.Unauthorized("invalid_credentials", "invalid email or password")
+	ErrIncorrectPassword  = apperr.Validation("incorrect_password", "current password is incorrect")
+	ErrInvalidCursor      = apperr.Validation("invalid_cursor", "cursor is malformed or was issued for another sort")
 )
 
 // TableName sets the table name for GORM to 'user' (not the default 'users')
@@ -14,12 +31,191 @@ type User struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
+	Password  string    `json:"-"` // bcrypt hash, never serialized
 	CreatedAt time.Time `json:"createdAt" gorm:"column:createdAt"`
 	Role      string    `json:"role"`
+	// DeletedAt is set when the user is soft deleted; GORM then skips the row
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"column:deletedAt"`
+}
+
+// What deleting a user does to their orders
+const (
+	// OrdersRestrict refuses to delete users who have orders
+	OrdersRestrict = "restrict"
+	// OrdersCascade deletes the user's orders when the user is purged
+	OrdersCascade = "cascade"
+)
+
+// PurgeResult is what a purge of deleted users removed
+type PurgeResult struct {
+	UserIDs []int64
+	// Orders are the cascaded orders as they were before the delete, without items
+	Orders []*model.Order
 }
 
 type UserWithOrders struct {
 	User   *User          `json:"user"`
 	Orders []*model.Order `json:"orders"`
 }
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// userSortColumns maps the sort fields clients may use to their columns
+var userSortColumns = map[string]string{
+	"id":         `"id"`,
+	"created_at": `"createdAt"`,
+	"name":       `"name"`,
+	"email":      `"email"`,
+}
+
+// UserSort orders a user listing by one field; ties are broken by id in the
+// same direction so every row has a unique position for keyset pagination
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultUserSort lists the newest users first
+var DefaultUserSort = UserSort{Field: "created_at", Desc: true}
+
+// ParseUserSort reads a sort such as "name" or "-created_at" (descending)
+func ParseUserSort(s string) (UserSort, error) {
+	sort := UserSort{Field: strings.TrimPrefix(s, "-"), Desc: strings.HasPrefix(s, "-")}
+	if _, ok := userSortColumns[sort.Field]; !ok {
+		return UserSort{}, errors.New("sort must be one of id, created_at, name, email, optionally prefixed with -")
+	}
+	return sort, nil
+}
+
+func (s UserSort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Column returns the quoted column the sort is on
+func (s UserSort) Column() string {
+	return userSortColumns[s.Field]
+}
+
+// Direction returns ASC or DESC
+func (s UserSort) Direction() string {
+	if s.Desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// After returns the comparison operator selecting rows after a cursor
+func (s UserSort) After() string {
+	if s.Desc {
+		return "<"
+	}
+	return ">"
+}
+
+// UserCursor is the position of the last user of a page. The next page starts
+// right after it. It is only valid for the sort it was issued for.
+type UserCursor struct {
+	Sort      string    `json:"s"`
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"c,omitzero"`
+	Name      string    `json:"n,omitempty"`
+	Email     string    `json:"e,omitempty"`
+}
+
+// NewUserCursor returns the cursor positioned at u under sort
+func NewUserCursor(sort UserSort, u *User) UserCursor {
+	c := UserCursor{Sort: sort.String(), ID: int64(u.ID)}
+	switch sort.Field {
+	case "created_at":
+		c.CreatedAt = u.CreatedAt
+	case "name":
+		c.Name = u.Name
+	case "email":
+		c.Email = u.Email
+	}
+	return c
+}
+
+// Value returns the cursor's value of the sort column
+func (c UserCursor) Value(sort UserSort) any {
+	switch sort.Field {
+	case "created_at":
+		return c.CreatedAt
+	case "name":
+		return c.Name
+	case "email":
+		return c.Email
+	}
+	return c.ID
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c UserCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeUserCursor parses a cursor returned by Encode and checks that it was issued for sort
+func DecodeUserCursor(s string, sort UserSort) (*UserCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c UserCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort.String() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// UserFilter selects users for listing. Zero values mean "no filter".
+type UserFilter struct {
+	Role string
+	// Email matches any part of the address, case-insensitively
+	Email string
+	// CreatedFrom is inclusive, CreatedTo is exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Deleted is "" to leave out soft-deleted users, "include" or "only"
+	Deleted string
+	Sort    UserSort
+	// After is the cursor of the previous page, nil for the first page
+	After *UserCursor
+	Limit int
+	// WithTotal also counts every user matching the filter
+	WithTotal bool
+}
+
+// Normalize applies the default sort and clamps the page size
+func (f *UserFilter) Normalize() {
+	if f.Sort.Field == "" {
+		f.Sort = DefaultUserSort
+	}
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+}
+
+// EmailPattern returns the ILIKE pattern for the email filter
+func (f *UserFilter) EmailPattern() string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Email)
+	return "%" + escaped + "%"
+}
+
+// UserPage is one page of a user listing
+type UserPage struct {
+	Users []*User
+	// Next is the cursor of the following page, nil on the last page
+	Next *UserCursor
+	// Total is only set when the filter asked for it
+	Total *int64
+}
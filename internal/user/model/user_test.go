@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseUserSort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want UserSort
+	}{
+		{"id", UserSort{Field: "id"}},
+		{"-id", UserSort{Field: "id", Desc: true}},
+		{"created_at", UserSort{Field: "created_at"}},
+		{"-created_at", UserSort{Field: "created_at", Desc: true}},
+		{"name", UserSort{Field: "name"}},
+		{"-email", UserSort{Field: "email", Desc: true}},
+	}
+	for _, tt := range tests {
+		got, err := ParseUserSort(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseUserSort(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("ParseUserSort(%q).String() = %q", tt.in, got.String())
+		}
+	}
+	for _, in := range []string{"", "-", "password", "createdAt", "+name", "--name", "name,id"} {
+		if _, err := ParseUserSort(in); err == nil {
+			t.Errorf("ParseUserSort(%q) succeeded", in)
+		}
+	}
+}
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	u := &User{
+		ID:        42,
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 678, time.UTC),
+	}
+	tests := []struct {
+		sort  string
+		value any
+	}{
+		{"id", int64(42)},
+		{"-created_at", u.CreatedAt},
+		{"name", "Alice"},
+		{"-email", "alice@example.com"},
+	}
+	for _, tt := range tests {
+		sort, err := ParseUserSort(tt.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := DecodeUserCursor(NewUserCursor(sort, u).Encode(), sort)
+		if err != nil {
+			t.Errorf("%s: decode: %v", tt.sort, err)
+			continue
+		}
+		if c.ID != 42 {
+			t.Errorf("%s: cursor id = %d, want 42", tt.sort, c.ID)
+		}
+		got := c.Value(sort)
+		if ts, ok := got.(time.Time); ok {
+			if !ts.Equal(tt.value.(time.Time)) {
+				t.Errorf("%s: cursor value = %v, want %v", tt.sort, got, tt.value)
+			}
+		} else if got != tt.value {
+			t.Errorf("%s: cursor value = %v, want %v", tt.sort, got, tt.value)
+		}
+	}
+}
+
+func TestDecodeUserCursorRejectsMalformedCursors(t *testing.T) {
+	name := UserSort{Field: "name"}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := map[string]string{
+		"empty":            "",
+		"not base64":       "!!not-base64!!",
+		"padded base64":    base64.URLEncoding.EncodeToString([]byte(`{"s":"name","id":1}`)),
+		"not JSON":         encode("name:1"),
+		"wrong JSON type":  encode(`{"s":"name","id":"1"}`),
+		"no sort":          encode(`{"id":1,"n":"Alice"}`),
+		"other sort":       NewUserCursor(UserSort{Field: "email"}, &User{ID: 1}).Encode(),
+		"other direction":  NewUserCursor(UserSort{Field: "name", Desc: true}, &User{ID: 1}).Encode(),
+		"trailing garbage": NewUserCursor(name, &User{ID: 1}).Encode() + "x",
+	}
+	for label, cursor := range tests {
+		if c, err := DecodeUserCursor(cursor, name); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: DecodeUserCursor = %+v, %v; want ErrInvalidCursor", label, c, err)
+		}
+	}
+}
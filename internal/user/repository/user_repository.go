@@ -3,44 +3,99 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-template/internal/metrics"
 	"go-template/internal/user/model"
-	"go-template/pkg/redisclient"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// userCache is the cache name used in metrics
+	userCache    = "user"
+	userCacheTTL = 10 * time.Minute
 )
 
 // UserRepository defines the contract for user data access (interface)
 // This allows you to abstract the data layer and easily switch implementations (e.g., GORM, SQL, mock).
 type UserRepository interface {
-	CreateUser(user *model.User) error
-	GetUserByID(id int64) (*model.User, error)
-	GetUserByIDWithCache(id int64) (*model.User, error)
-	GetUserByEmail(email string) (*model.User, error)
-	UpdateUser(user *model.User) error
-	DeleteUser(id int64) error
+	CreateUser(ctx context.Context, user *model.User) error
+	GetUserByID(ctx context.Context, id int64) (*model.User, error)
+	// GetUserByIDForUpdate is GetUserByID locking the row until the
+	// surrounding transaction ends
+	GetUserByIDForUpdate(ctx context.Context, id int64) (*model.User, error)
+	GetUserByIDWithCache(ctx context.Context, id int64) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// ListUsers returns up to filter.Limit users after filter.After, in filter.Sort order.
+	// Listed users carry no password hash.
+	ListUsers(ctx context.Context, filter model.UserFilter) ([]*model.User, error)
+	// CountUsers returns the number of users matching filter, ignoring its cursor and limit
+	CountUsers(ctx context.Context, filter model.UserFilter) (int64, error)
+	// UpdateUser changes the name and email of an existing user
+	UpdateUser(ctx context.Context, user *model.User) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	UpdateRole(ctx context.Context, id int64, role string) error
+	// DeleteUser soft deletes a user: it is hidden from every query until it is restored or purged
+	DeleteUser(ctx context.Context, id int64) error
+	// RestoreUser undoes the soft delete of a user that has not been purged yet
+	RestoreUser(ctx context.Context, id int64) error
+	// PurgeDeletedUsers permanently removes the users soft deleted before
+	// deletedBefore and returns what it removed. With cascadeOrders their
+	// orders are removed too; otherwise users that still have orders are kept.
+	// It holds an advisory lock until the transaction ends and removes nothing
+	// while another instance is purging.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, cascadeOrders bool) (*model.PurgeResult, error)
 }
 
 // GormUserRepository implements UserRepository using GORM
 type GormUserRepository struct {
 	DB *gorm.DB
+	// Redis caches users read with GetUserByIDWithCache; nil disables the cache
+	Redis *redis.Client
+	Log   *slog.Logger
+	// AfterCommit, when set, defers work until the surrounding transaction
+	// has committed. Cached users are only dropped then, otherwise a
+	// concurrent cache miss could store the old row again before the commit.
+	AfterCommit func(fn func())
 }
 
 // NewUserRepository returns a UserRepository implemented with GORM.
 // Pass a *gorm.DB instance to use as the database connection.
-func NewUserRepository(db *gorm.DB) UserRepository {
-	return &GormUserRepository{DB: db}
+func NewUserRepository(db *gorm.DB, rdb *redis.Client, logger *slog.Logger) UserRepository {
+	return &GormUserRepository{DB: db, Redis: rdb, Log: logger}
+}
+
+// NewUserRepositoryInTx returns a UserRepository running on the transaction
+// tx. Cache entries of changed users are dropped through afterCommit.
+func NewUserRepositoryInTx(tx *gorm.DB, rdb *redis.Client, logger *slog.Logger, afterCommit func(fn func())) UserRepository {
+	return &GormUserRepository{DB: tx, Redis: rdb, Log: logger, AfterCommit: afterCommit}
 }
 
-func (r *GormUserRepository) CreateUser(user *model.User) error {
-	result := r.DB.Create(user)
+func (r *GormUserRepository) CreateUser(ctx context.Context, user *model.User) error {
+	result := r.DB.WithContext(ctx).Create(user)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return model.ErrEmailTaken
+	}
 	return result.Error
 }
 
-func (r *GormUserRepository) GetUserByID(id int64) (*model.User, error) {
+func (r *GormUserRepository) GetUserByID(ctx context.Context, id int64) (*model.User, error) {
+	return r.getUser(r.DB.WithContext(ctx), id)
+}
+
+func (r *GormUserRepository) GetUserByIDForUpdate(ctx context.Context, id int64) (*model.User, error) {
+	return r.getUser(r.DB.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), id)
+}
+
+func (r *GormUserRepository) getUser(q *gorm.DB, id int64) (*model.User, error) {
 	var user model.User
-	result := r.DB.First(&user, id)
+	result := q.First(&user, id)
 	if result.Error == gorm.ErrRecordNotFound {
 		return nil, nil
 	}
@@ -50,37 +105,103 @@ func (r *GormUserRepository) GetUserByID(id int64) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *GormUserRepository) GetUserByIDWithCache(id int64) (*model.User, error) {
-	cacheKey := fmt.Sprintf("user:%d", id)
-	if redisclient.Rdb != nil {
-		if val, err := redisclient.Rdb.Get(context.Background(), cacheKey).Result(); err == nil {
-			var u model.User
-			if err := json.Unmarshal([]byte(val), &u); err == nil {
-				fmt.Println("[GetUserByIDWithCache] source: cache")
-				return &u, nil // cache hit
-			}
-		}
+func (r *GormUserRepository) GetUserByIDWithCache(ctx context.Context, id int64) (*model.User, error) {
+	cacheKey := userCacheKey(id)
+	if u, ok := getCachedUser(ctx, r.Redis, r.Log, cacheKey); ok {
+		return u, nil // cache hit
 	}
 	var u model.User
-	result := r.DB.First(&u, id)
+	result := r.DB.WithContext(ctx).First(&u, id)
 	if result.Error == gorm.ErrRecordNotFound {
 		return nil, nil
 	}
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	if redisclient.Rdb != nil {
-		if bytes, err := json.Marshal(u); err == nil {
-			_ = redisclient.Rdb.Set(context.Background(), cacheKey, bytes, 10*time.Minute).Err()
-		}
-	}
-	fmt.Println("[GetUserByIDWithCache] source: db")
+	setCachedUser(ctx, r.Redis, r.Log, cacheKey, &u)
+	u.Password = "" // Match what a cache hit returns
 	return &u, nil
 }
 
-func (r *GormUserRepository) GetUserByEmail(email string) (*model.User, error) {
+// cachedUser is the Redis representation of a user. It deliberately has no
+// password field so hashes are never written to the cache.
+type cachedUser struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newCachedUser(u *model.User) cachedUser {
+	return cachedUser{ID: u.ID, Name: u.Name, Email: u.Email, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+func (cu cachedUser) toUser() *model.User {
+	return &model.User{ID: cu.ID, Name: cu.Name, Email: cu.Email, Role: cu.Role, CreatedAt: cu.CreatedAt}
+}
+
+// getCachedUser looks up a user in Redis and counts the hit, miss or error.
+// Any cache failure is logged and treated as a miss so the caller falls back to the database.
+func getCachedUser(ctx context.Context, rdb *redis.Client, log *slog.Logger, key string) (*model.User, bool) {
+	if rdb == nil {
+		return nil, false
+	}
+	val, err := rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		metrics.CacheResult(userCache, metrics.CacheMiss)
+		return nil, false
+	}
+	if err != nil {
+		metrics.CacheResult(userCache, metrics.CacheError)
+		log.WarnContext(ctx, "user cache read failed", "key", key, "error", err)
+		return nil, false
+	}
+	var cu cachedUser
+	if err := json.Unmarshal([]byte(val), &cu); err != nil {
+		metrics.CacheResult(userCache, metrics.CacheError)
+		log.WarnContext(ctx, "user cache entry is corrupt", "key", key, "error", err)
+		return nil, false
+	}
+	metrics.CacheResult(userCache, metrics.CacheHit)
+	return cu.toUser(), true
+}
+
+// deleteCachedUser removes a user from Redis after it changed, so readers
+// do not see the old data for the rest of userCacheTTL. The change must be
+// committed already, see GormUserRepository.AfterCommit.
+func deleteCachedUser(ctx context.Context, rdb *redis.Client, log *slog.Logger, id int64) {
+	if rdb == nil {
+		return
+	}
+	if err := rdb.Del(ctx, userCacheKey(id)).Err(); err != nil {
+		metrics.CacheResult(userCache, metrics.CacheError)
+		log.WarnContext(ctx, "user cache invalidation failed", "user_id", id, "error", err)
+	}
+}
+
+func userCacheKey(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+// setCachedUser stores a user, without credentials, in Redis for userCacheTTL
+func setCachedUser(ctx context.Context, rdb *redis.Client, log *slog.Logger, key string, u *model.User) {
+	if rdb == nil {
+		return
+	}
+	bytes, err := json.Marshal(newCachedUser(u))
+	if err != nil {
+		return
+	}
+	if err := rdb.Set(ctx, key, bytes, userCacheTTL).Err(); err != nil {
+		metrics.CacheResult(userCache, metrics.CacheError)
+		log.WarnContext(ctx, "user cache write failed", "key", key, "error", err)
+	}
+}
+
+func (r *GormUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	var user model.User
-	result := r.DB.Where("email = ?", email).First(&user)
+	result := r.DB.WithContext(ctx).Where("email = ?", email).First(&user)
 	if result.Error == gorm.ErrRecordNotFound {
 		return nil, nil
 	}
@@ -90,18 +211,182 @@ func (r *GormUserRepository) GetUserByEmail(email string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *GormUserRepository) UpdateUser(user *model.User) error {
-	result := r.DB.Save(user)
+func (r *GormUserRepository) ListUsers(ctx context.Context, filter model.UserFilter) ([]*model.User, error) {
+	// Unscoped because userConditions handles soft-deleted users itself
+	q := r.DB.WithContext(ctx).Unscoped().Model(&model.User{}).Select(userListColumns)
+	if where, args := userConditions(filter, true); where != "" {
+		q = q.Where(where, args...)
+	}
+	var users []*model.User
+	result := q.Order(userOrderBy(filter.Sort)).Limit(filter.Limit).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+func (r *GormUserRepository) CountUsers(ctx context.Context, filter model.UserFilter) (int64, error) {
+	q := r.DB.WithContext(ctx).Unscoped().Model(&model.User{})
+	if where, args := userConditions(filter, false); where != "" {
+		q = q.Where(where, args...)
+	}
+	var total int64
+	err := q.Count(&total).Error
+	return total, err
+}
+
+// userListColumns are the columns loaded when listing users, everything but the password
+const userListColumns = `"id", "name", "email", "createdAt", "role", "deletedAt"`
+
+// userConditions returns the WHERE clause, with ? placeholders, selecting the
+// users matching filter. With keyset it also selects only rows after filter.After.
+func userConditions(filter model.UserFilter, keyset bool) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, condArgs ...any) {
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+	switch filter.Deleted {
+	case "include":
+	case "only":
+		add(`"deletedAt" IS NOT NULL`)
+	default:
+		add(`"deletedAt" IS NULL`)
+	}
+	if filter.Role != "" {
+		add(`"role" = ?`, filter.Role)
+	}
+	if filter.Email != "" {
+		add(`"email" ILIKE ?`, filter.EmailPattern())
+	}
+	if filter.CreatedFrom != nil {
+		add(`"createdAt" >= ?`, *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add(`"createdAt" < ?`, *filter.CreatedTo)
+	}
+	if keyset && filter.After != nil {
+		sort := filter.Sort
+		if sort.Field == "id" {
+			add(`"id" `+sort.After()+` ?`, filter.After.ID)
+		} else {
+			add(fmt.Sprintf(`(%s, "id") %s (?, ?)`, sort.Column(), sort.After()), filter.After.Value(sort), filter.After.ID)
+		}
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// userOrderBy returns the ORDER BY clause for sort, with id as the tie breaker
+func userOrderBy(sort model.UserSort) string {
+	if sort.Field == "id" {
+		return `"id" ` + sort.Direction()
+	}
+	return fmt.Sprintf(`%s %s, "id" %s`, sort.Column(), sort.Direction(), sort.Direction())
+}
+
+func (r *GormUserRepository) UpdateUser(ctx context.Context, user *model.User) error {
+	return r.update(ctx, int64(user.ID), map[string]any{"name": user.Name, "email": user.Email})
+}
+
+func (r *GormUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	return r.update(ctx, id, map[string]any{"password": passwordHash})
+}
+
+func (r *GormUserRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	return r.update(ctx, id, map[string]any{"role": role})
+}
+
+// update sets the given columns of an existing user and drops the cached copy
+func (r *GormUserRepository) update(ctx context.Context, id int64, columns map[string]any) error {
+	result := r.DB.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Updates(columns)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return model.ErrEmailTaken
+	}
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		return model.ErrUserNotFound
 	}
-	return result.Error
+	r.dropCachedUser(ctx, id)
+	return nil
 }
 
-func (r *GormUserRepository) DeleteUser(id int64) error {
-	result := r.DB.Delete(&model.User{}, id)
+func (r *GormUserRepository) DeleteUser(ctx context.Context, id int64) error {
+	// User has a gorm.DeletedAt field, so this sets "deletedAt" instead of deleting the row
+	result := r.DB.WithContext(ctx).Delete(&model.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		return model.ErrUserNotFound
 	}
-	return result.Error
+	r.dropCachedUser(ctx, id)
+	return nil
+}
+
+// dropCachedUser removes a changed user from Redis once the change is visible
+// to other connections
+func (r *GormUserRepository) dropCachedUser(ctx context.Context, id int64) {
+	if r.AfterCommit == nil {
+		deleteCachedUser(ctx, r.Redis, r.Log, id)
+		return
+	}
+	// The request may be over by the time the commit happens
+	ctx = context.WithoutCancel(ctx)
+	r.AfterCommit(func() { deleteCachedUser(ctx, r.Redis, r.Log, id) })
+}
+
+func (r *GormUserRepository) RestoreUser(ctx context.Context, id int64) error {
+	result := r.DB.WithContext(ctx).Unscoped().Model(&model.User{}).
+		Where(`"id" = ? AND "deletedAt" IS NOT NULL`, id).
+		Update("deletedAt", nil)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return model.ErrEmailTaken
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrUserNotFound
+	}
+	return nil
 }
+
+func (r *GormUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, cascadeOrders bool) (*model.PurgeResult, error) {
+	purged := &model.PurgeResult{}
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw(purgeLockQuery, purgeLockKey).Scan(&locked).Error; err != nil || !locked {
+			return err
+		}
+		if cascadeOrders {
+			if err := tx.Raw(purgeOrdersQuery, deletedBefore).Scan(&purged.Orders).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Raw(purgeUsersQuery, deletedBefore).Scan(&purged.UserIDs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// purgeLockKey identifies the Postgres advisory lock held while purging, so
+// two instances never purge, audit and publish the same rows twice
+const purgeLockKey int64 = 7_345_112_010
+
+const (
+	// purgeLockQuery takes the purge lock until the transaction ends, if it is free
+	purgeLockQuery = `SELECT pg_try_advisory_xact_lock(?)`
+	// purgeOrdersQuery deletes the orders of expired users; their items and
+	// status history go with them through ON DELETE CASCADE
+	purgeOrdersQuery = `DELETE FROM "order" WHERE "userId" IN (SELECT "id" FROM "user" WHERE "deletedAt" < ?)
+		RETURNING "id", "product", "priceAmount", "priceCurrency", "userId", "status", "createdAt"`
+	// purgeUsersQuery deletes expired users that no order refers to any more
+	purgeUsersQuery = `DELETE FROM "user" WHERE "deletedAt" < ?
+		AND NOT EXISTS (SELECT 1 FROM "order" WHERE "order"."userId" = "user"."id")
+		RETURNING "id"`
+)
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go-template/internal/user/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const passwordHash = "$2a$10$abcdefghijklmnopqrstuuC3M8v5zV0Jb6w8tW2pXn7y1QeYqXhS"
+
+func TestCachedUserNeverStoresCredentials(t *testing.T) {
+	u := &model.User{
+		ID:        7,
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		Password:  passwordHash,
+		Role:      "admin",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	// This is the value setCachedUser writes to Redis
+	b, err := json.Marshal(newCachedUser(u))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(b), passwordHash) {
+		t.Errorf("password hash written to the cache entry: %s", b)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for k := range fields {
+		if strings.Contains(strings.ToLower(k), "password") {
+			t.Errorf("cache entry has a %q key: %s", k, b)
+		}
+	}
+
+	var cu cachedUser
+	if err := json.Unmarshal(b, &cu); err != nil {
+		t.Fatalf("unmarshal cache entry: %v", err)
+	}
+	got := cu.toUser()
+	if got.Password != "" {
+		t.Errorf("user read from the cache has a password: %q", got.Password)
+	}
+	if got.ID != u.ID || got.Email != u.Email || got.Role != u.Role || !got.CreatedAt.Equal(u.CreatedAt) {
+		t.Errorf("cache round trip lost profile fields: %+v", got)
+	}
+}
+
+// fakeRedis answers SET and GET from a map instead of a server, so the cache
+// code runs unchanged against a client with this hook
+type fakeRedis struct {
+	values map[string]string
+}
+
+func (f *fakeRedis) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (f *fakeRedis) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		switch c := cmd.(type) {
+		case *redis.StatusCmd: // SET key value EX ttl
+			f.values[args[1].(string)] = string(args[2].([]byte))
+			c.SetVal("OK")
+		case *redis.StringCmd: // GET key
+			v, ok := f.values[args[1].(string)]
+			if !ok {
+				c.SetErr(redis.Nil)
+				return redis.Nil
+			}
+			c.SetVal(v)
+		}
+		return nil
+	}
+}
+
+func (f *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestUserCacheEntryHasNoPasswordHash(t *testing.T) {
+	fake := &fakeRedis{values: map[string]string{}}
+	rdb := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	rdb.AddHook(fake)
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	u := &model.User{ID: 7, Name: "Alice", Email: "alice@example.com", Password: passwordHash, Role: "admin"}
+	key := userCacheKey(int64(u.ID))
+	setCachedUser(ctx, rdb, log, key, u)
+
+	entry, ok := fake.values[key]
+	if !ok {
+		t.Fatalf("user was not written to the cache, got keys %v", fake.values)
+	}
+	if strings.Contains(entry, passwordHash) || strings.Contains(strings.ToLower(entry), "password") {
+		t.Errorf("cache entry carries credentials: %s", entry)
+	}
+	got, ok := getCachedUser(ctx, rdb, log, key)
+	if !ok {
+		t.Fatal("cached user was not read back")
+	}
+	if got.Password != "" || got.Email != u.Email {
+		t.Errorf("cached user = %+v", got)
+	}
+}
+
+func TestUserKeysetConditions(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	last := &model.User{ID: 42, Name: "Alice", Email: "alice@example.com", CreatedAt: created}
+	tests := []struct {
+		sort    string
+		where   string
+		args    []any
+		orderBy string
+	}{
+		{"id", `"id" > ?`, []any{int64(42)}, `"id" ASC`},
+		{"-id", `"id" < ?`, []any{int64(42)}, `"id" DESC`},
+		{"created_at", `("createdAt", "id") > (?, ?)`, []any{created, int64(42)}, `"createdAt" ASC, "id" ASC`},
+		{"-created_at", `("createdAt", "id") < (?, ?)`, []any{created, int64(42)}, `"createdAt" DESC, "id" DESC`},
+		{"name", `("name", "id") > (?, ?)`, []any{"Alice", int64(42)}, `"name" ASC, "id" ASC`},
+		{"-name", `("name", "id") < (?, ?)`, []any{"Alice", int64(42)}, `"name" DESC, "id" DESC`},
+		{"email", `("email", "id") > (?, ?)`, []any{"alice@example.com", int64(42)}, `"email" ASC, "id" ASC`},
+		{"-email", `("email", "id") < (?, ?)`, []any{"alice@example.com", int64(42)}, `"email" DESC, "id" DESC`},
+	}
+	for _, tt := range tests {
+		sort, err := model.ParseUserSort(tt.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor := model.NewUserCursor(sort, last)
+		filter := model.UserFilter{Sort: sort, After: &cursor}
+
+		where, args := userConditions(filter, true)
+		if want := `"deletedAt" IS NULL AND ` + tt.where; where != want {
+			t.Errorf("%s: where = %s, want %s", tt.sort, where, want)
+		}
+		if len(args) != len(tt.args) {
+			t.Errorf("%s: args = %v, want %v", tt.sort, args, tt.args)
+		} else {
+			for i := range args {
+				if args[i] != tt.args[i] {
+					t.Errorf("%s: arg %d = %v, want %v", tt.sort, i, args[i], tt.args[i])
+				}
+			}
+		}
+		if got := userOrderBy(sort); got != tt.orderBy {
+			t.Errorf("%s: order by = %s, want %s", tt.sort, got, tt.orderBy)
+		}
+		// Counting the total ignores the cursor
+		if where, args := userConditions(filter, false); where != `"deletedAt" IS NULL` || len(args) != 0 {
+			t.Errorf("%s: count conditions = %s %v", tt.sort, where, args)
+		}
+	}
+}
@@ -3,43 +3,58 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	orderModel "go-template/internal/order/model"
 	user "go-template/internal/user/model"
-	"go-template/pkg/redisclient"
+	"log/slog"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
 // UserSqlRepository defines the contract for user data access using *sql.DB (example)
 type UserSqlRepository struct {
 	DB *sql.DB
+	// Redis caches users read with GetUserByIDWithCache; nil disables the cache
+	Redis *redis.Client
+	Log   *slog.Logger
 }
 
 // NewUserSqlRepository creates a new UserSqlRepository instance
-func NewUserSqlRepository(db *sql.DB) *UserSqlRepository {
-	return &UserSqlRepository{DB: db}
+func NewUserSqlRepository(db *sql.DB, rdb *redis.Client, logger *slog.Logger) *UserSqlRepository {
+	return &UserSqlRepository{DB: db, Redis: rdb, Log: logger}
 }
 
-func (r *UserSqlRepository) CreateUser(user *user.User) error {
-	err := r.DB.QueryRow(
+func (r *UserSqlRepository) CreateUser(ctx context.Context, u *user.User) error {
+	err := r.DB.QueryRowContext(ctx,
 		`INSERT INTO "user" ("name", "email", "password", "role")
 		VALUES ($1, $2, $3, $4)
 		RETURNING "id", "createdAt"`,
-		user.Name, user.Email, user.Password, user.Role,
-	).Scan(&user.ID, &user.CreatedAt)
-	if err != nil {
-		return err
+		u.Name, u.Email, u.Password, u.Role,
+	).Scan(&u.ID, &u.CreatedAt)
+	if pqErrorName(err) == "unique_violation" {
+		return user.ErrEmailTaken
 	}
-	return nil
+	return err
+}
+
+const getUserQuery = `SELECT "id", "name", "email", "password", "createdAt", "role"
+	FROM "user" WHERE "id" = $1 AND "deletedAt" IS NULL`
+
+func (r *UserSqlRepository) GetUserByID(ctx context.Context, id int64) (*user.User, error) {
+	return r.getUser(ctx, getUserQuery, id)
+}
+
+func (r *UserSqlRepository) GetUserByIDForUpdate(ctx context.Context, id int64) (*user.User, error) {
+	return r.getUser(ctx, getUserQuery+" FOR UPDATE", id)
 }
 
-func (r *UserSqlRepository) GetUserByID(id int64) (*user.User, error) {
+func (r *UserSqlRepository) getUser(ctx context.Context, query string, id int64) (*user.User, error) {
 	var user user.User
-	err := r.DB.QueryRow(
-		`SELECT "id", "name", "email", "password", "createdAt", "role"
-		FROM "user" WHERE "id" = $1`,
-		id,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.Role)
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.Role)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -48,26 +63,21 @@ func (r *UserSqlRepository) GetUserByID(id int64) (*user.User, error) {
 	return &user, nil
 }
 
-func (r *UserSqlRepository) GetUserByIDWithCache(id int64) (*user.User, error) {
-	cacheKey := fmt.Sprintf("user:%d", id)
+func (r *UserSqlRepository) GetUserByIDWithCache(ctx context.Context, id int64) (*user.User, error) {
+	cacheKey := userCacheKey(id)
 
 	// 1. Try Redis cache first
-	if redisclient.Rdb != nil {
-		if val, err := redisclient.Rdb.Get(context.Background(), cacheKey).Result(); err == nil {
-			var u user.User
-			if err := json.Unmarshal([]byte(val), &u); err == nil {
-				return &u, nil // cache hit
-			}
-		}
+	if u, ok := getCachedUser(ctx, r.Redis, r.Log, cacheKey); ok {
+		return u, nil // cache hit
 	}
 
-	// 2. Query DB if cache miss
+	// 2. Query DB if cache miss; the password hash is never cached, so it is not selected either
 	var u user.User
-	err := r.DB.QueryRow(
-		`SELECT "id", "name", "email", "password", "createdAt", "role" 
-		FROM "user" WHERE "id" = $1`,
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT "id", "name", "email", "createdAt", "role" 
+		FROM "user" WHERE "id" = $1 AND "deletedAt" IS NULL`,
 		id,
-	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.CreatedAt, &u.Role)
+	).Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.Role)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -76,21 +86,17 @@ func (r *UserSqlRepository) GetUserByIDWithCache(id int64) (*user.User, error) {
 	}
 
 	// 3. Save result into Redis (cache for 10 minutes)
-	if redisclient.Rdb != nil {
-		if bytes, err := json.Marshal(u); err == nil {
-			_ = redisclient.Rdb.Set(context.Background(), cacheKey, bytes, 10*time.Minute).Err()
-		}
-	}
+	setCachedUser(ctx, r.Redis, r.Log, cacheKey, &u)
 
 	return &u, nil
 }
 
-func (r *UserSqlRepository) GetUserByEmail(email string) (*user.User, error) {
+func (r *UserSqlRepository) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
 	var user user.User
-	err := r.DB.QueryRow(
+	err := r.DB.QueryRowContext(ctx,
 		`SELECT "id", "name", "email", "password", "role"
           FROM "user"
-          WHERE "email" = $1`,
+          WHERE "email" = $1 AND "deletedAt" IS NULL`,
 		email,
 	).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role)
 
@@ -102,29 +108,173 @@ func (r *UserSqlRepository) GetUserByEmail(email string) (*user.User, error) {
 	return &user, nil
 }
 
-func (r *UserSqlRepository) UpdateUser(user *user.User) error {
-	res, err := r.DB.Exec(
-		`UPDATE "user" SET "name"=$1, "email"=$2, "password"=$3, "role"=$4 WHERE "id"=$5`,
-		user.Name, user.Email, user.Password, user.Role, user.ID,
-	)
+func (r *UserSqlRepository) ListUsers(ctx context.Context, filter user.UserFilter) ([]*user.User, error) {
+	query := `SELECT ` + userListColumns + ` FROM "user"`
+	where, args := userConditions(filter, true)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY " + userOrderBy(filter.Sort) + " LIMIT ?"
+	args = append(args, filter.Limit)
+	rows, err := r.DB.QueryContext(ctx, rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []*user.User
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.Role, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &u)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserSqlRepository) CountUsers(ctx context.Context, filter user.UserFilter) (int64, error) {
+	query := `SELECT COUNT(*) FROM "user"`
+	where, args := userConditions(filter, false)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	var total int64
+	err := r.DB.QueryRowContext(ctx, rebind(query), args...).Scan(&total)
+	return total, err
+}
+
+// rebind replaces the ? placeholders of query with Postgres' $1, $2, ...
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "$%d", n)
+	}
+	return b.String()
+}
+
+func (r *UserSqlRepository) UpdateUser(ctx context.Context, u *user.User) error {
+	return r.update(ctx, int64(u.ID), `UPDATE "user" SET "name"=$1, "email"=$2 WHERE "id"=$3 AND "deletedAt" IS NULL`, u.Name, u.Email, u.ID)
+}
+
+func (r *UserSqlRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	return r.update(ctx, id, `UPDATE "user" SET "password"=$1 WHERE "id"=$2 AND "deletedAt" IS NULL`, passwordHash, id)
+}
+
+func (r *UserSqlRepository) UpdateRole(ctx context.Context, id int64, role string) error {
+	return r.update(ctx, id, `UPDATE "user" SET "role"=$1 WHERE "id"=$2 AND "deletedAt" IS NULL`, role, id)
+}
+
+// update runs an UPDATE of the user with the given id and drops the cached copy
+func (r *UserSqlRepository) update(ctx context.Context, id int64, query string, args ...any) error {
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if pqErrorName(err) == "unique_violation" {
+		return user.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return user.ErrUserNotFound
+	}
+	deleteCachedUser(ctx, r.Redis, r.Log, id)
+	return nil
+}
+
+func (r *UserSqlRepository) DeleteUser(ctx context.Context, id int64) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE "user" SET "deletedAt"=now() WHERE "id"=$1 AND "deletedAt" IS NULL`, id)
 	if err != nil {
 		return err
 	}
 	rows, _ := res.RowsAffected()
 	if rows == 0 {
-		return sql.ErrNoRows
+		return user.ErrUserNotFound
 	}
+	deleteCachedUser(ctx, r.Redis, r.Log, id)
 	return nil
 }
 
-func (r *UserSqlRepository) DeleteUser(id int64) error {
-	res, err := r.DB.Exec(`DELETE FROM "user" WHERE "id"=$1`, id)
+func (r *UserSqlRepository) RestoreUser(ctx context.Context, id int64) error {
+	res, err := r.DB.ExecContext(ctx, `UPDATE "user" SET "deletedAt"=NULL WHERE "id"=$1 AND "deletedAt" IS NOT NULL`, id)
+	if pqErrorName(err) == "unique_violation" {
+		return user.ErrEmailTaken
+	}
 	if err != nil {
 		return err
 	}
 	rows, _ := res.RowsAffected()
 	if rows == 0 {
-		return sql.ErrNoRows
+		return user.ErrUserNotFound
 	}
 	return nil
 }
+
+func (r *UserSqlRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, cascadeOrders bool) (*user.PurgeResult, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	purged := &user.PurgeResult{}
+	var locked bool
+	if err := tx.QueryRowContext(ctx, rebind(purgeLockQuery), purgeLockKey).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return purged, nil
+	}
+	if cascadeOrders {
+		if purged.Orders, err = purgeOrders(ctx, tx, deletedBefore); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, rebind(purgeUsersQuery), deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		purged.UserIDs = append(purged.UserIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return purged, tx.Commit()
+}
+
+// purgeOrders deletes the orders of expired users and returns them
+func purgeOrders(ctx context.Context, tx *sql.Tx, deletedBefore time.Time) ([]*orderModel.Order, error) {
+	rows, err := tx.QueryContext(ctx, rebind(purgeOrdersQuery), deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var orders []*orderModel.Order
+	for rows.Next() {
+		var o orderModel.Order
+		if err := rows.Scan(&o.ID, &o.Product, &o.Price.Amount, &o.Price.Currency, &o.UserID, &o.Status, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, &o)
+	}
+	return orders, rows.Err()
+}
+
+// pqErrorName returns the condition name of a Postgres error, e.g. unique_violation
+func pqErrorName(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Name()
+	}
+	return ""
+}
@@ -1,59 +1,144 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
 	"time"
 
+	auditModel "go-template/internal/audit/model"
+	"go-template/internal/auth"
+	"go-template/internal/common/apperr"
 	"go-template/internal/db"
 	orderModel "go-template/internal/order/model"
 	orderrepo "go-template/internal/order/repository"
+	orderservice "go-template/internal/order/service"
+	outboxModel "go-template/internal/outbox/model"
+	"go-template/internal/policy"
+	"go-template/internal/tracing"
 	userModel "go-template/internal/user/model"
 	userrepo "go-template/internal/user/repository"
 
-	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+var tracer = otel.Tracer("go-template/internal/user/service")
+
+var ErrUnknownRole = apperr.Validation("unknown_role", "role is not defined in the policy").
+	WithFields(apperr.FieldError{Field: "role", Code: "role", Message: "must be a defined role"})
 
 // UserService is responsible for user-related operations
 type UserService struct {
 	Repo      userrepo.UserRepository
 	OrderRepo orderrepo.OrderRepository
 	txManager db.TransactionManager
+	// tokens issues and revokes the sessions of users
+	tokens *auth.Manager
+	// roles are the roles users may be given
+	roles *policy.Engine
+	log   *slog.Logger
+	// ordersOnDelete is userModel.OrdersRestrict (the default) or OrdersCascade
+	ordersOnDelete string
+}
+
+// WithOrdersOnDelete sets what deleting a user does to their orders,
+// userModel.OrdersRestrict or userModel.OrdersCascade
+func (s *UserService) WithOrdersOnDelete(policy string) *UserService {
+	s.ordersOnDelete = policy
+	return s
 }
 
-func NewUserService(repo userrepo.UserRepository, orderRepo orderrepo.OrderRepository) *UserService {
-	return &UserService{Repo: repo, OrderRepo: orderRepo}
+// UserUpdate holds the profile fields a client may change; nil fields are left as is.
+// Passwords and roles are changed by ChangePassword and ChangeRole only.
+type UserUpdate struct {
+	Name  *string
+	Email *string
 }
 
-func NewUserServiceWithTx(repo userrepo.UserRepository, orderRepo orderrepo.OrderRepository, txManager db.TransactionManager) *UserService {
+func NewUserService(repo userrepo.UserRepository, orderRepo orderrepo.OrderRepository, tokens *auth.Manager, roles *policy.Engine, logger *slog.Logger) *UserService {
+	return &UserService{Repo: repo, OrderRepo: orderRepo, tokens: tokens, roles: roles, log: logger}
+}
+
+func NewUserServiceWithTx(repo userrepo.UserRepository, orderRepo orderrepo.OrderRepository, txManager db.TransactionManager, tokens *auth.Manager, roles *policy.Engine, logger *slog.Logger) *UserService {
 	return &UserService{
 		Repo:      repo,
 		OrderRepo: orderRepo,
 		txManager: txManager,
+		tokens:    tokens,
+		roles:     roles,
+		log:       logger,
 	}
 }
 
-func (s *UserService) GetUserByID(id int64) (*userModel.User, error) {
-	return s.Repo.GetUserByID(id)
+// GetUserByID returns a user or userModel.ErrUserNotFound
+func (s *UserService) GetUserByID(ctx context.Context, id int64) (_ *userModel.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return found(s.Repo.GetUserByID(ctx, id))
 }
 
-func (s *UserService) GetUserByIDWithCache(id int64) (*userModel.User, error) {
-	return s.Repo.GetUserByIDWithCache(id)
+func (s *UserService) GetUserByIDWithCache(ctx context.Context, id int64) (_ *userModel.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUserByIDWithCache", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return found(s.Repo.GetUserByIDWithCache(ctx, id))
+}
+
+// found turns the nil user repositories return for a missing row into ErrUserNotFound
+func found(user *userModel.User, err error) (*userModel.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, userModel.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ListUsers returns one page of users matching the filter and, if asked for,
+// the total number of matches
+func (s *UserService) ListUsers(ctx context.Context, filter userModel.UserFilter) (_ *userModel.UserPage, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ListUsers")
+	defer func() { tracing.End(span, err) }()
+	filter.Normalize()
+	// Fetch one extra user to learn whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	users, err := s.Repo.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &userModel.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		next := userModel.NewUserCursor(filter.Sort, page.Users[limit-1])
+		page.Next = &next
+	}
+	if filter.WithTotal {
+		total, err := s.Repo.CountUsers(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+	return page, nil
 }
 
 // GetUserWithOrders returns user and their orders by userID
-func (s *UserService) GetUserWithOrders(userID int64) (*userModel.UserWithOrders, error) {
-	usr, err := s.Repo.GetUserByID(userID)
+func (s *UserService) GetUserWithOrders(ctx context.Context, userID int64) (_ *userModel.UserWithOrders, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUserWithOrders", trace.WithAttributes(attribute.Int64("user.id", userID)))
+	defer func() { tracing.End(span, err) }()
+	usr, err := s.Repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get user failed: %w", err)
 	}
 	if usr == nil {
-		return nil, nil
+		return nil, userModel.ErrUserNotFound
 	}
-	orders, err := s.OrderRepo.GetOrdersByUserID(userID)
+	orders, err := s.OrderRepo.GetOrdersByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get orders failed: %w", err)
 	}
@@ -63,64 +148,455 @@ func (s *UserService) GetUserWithOrders(userID int64) (*userModel.UserWithOrders
 	}, nil
 }
 
-func (s *UserService) RegisterUser(user *userModel.User) error {
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+// RegisterUser hashes the password and stores a new user
+func (s *UserService) RegisterUser(ctx context.Context, user *userModel.User) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RegisterUser")
+	defer func() { tracing.End(span, err) }()
+	if !s.roles.HasRole(user.Role) {
+		return ErrUnknownRole
+	}
+	if user.Password, err = hashPassword(user.Password); err != nil {
+		return err
+	}
+	uow, err := s.txManager.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+		return err
 	}
-	user.Password = string(hashedPassword)
-	return s.Repo.CreateUser(user)
+	defer uow.Rollback() // Rollback if any error occurs
+
+	if err := uow.UserRepo().CreateUser(ctx, user); err != nil {
+		return err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionCreate, int64(user.ID), nil, auditModel.Snapshot(user)); err != nil {
+		return err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserRegistered, int64(user.ID), outboxModel.UserRegistered{
+		UserID:    int64(user.ID),
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "user registered", "user_id", user.ID)
+	return nil
 }
 
-func (s *UserService) LoginUser(email, password string) (string, error) {
-	user, err := s.Repo.GetUserByEmail(email)
+// LoginUser checks the credentials and starts a new session with an access and refresh token
+func (s *UserService) LoginUser(ctx context.Context, email, password string) (_ *auth.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.LoginUser")
+	defer func() { tracing.End(span, err) }()
+	user, err := s.Repo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", fmt.Errorf("failed to query user: %w", err)
+		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
-		return "", fmt.Errorf("invalid email or password")
+		s.log.WarnContext(ctx, "login failed", "email", email)
+		return nil, userModel.ErrInvalidCredentials
+	}
+
+	tokens, err := s.tokens.IssueTokens(ctx, subjectOf(user))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	return tokens, nil
+}
+
+// RefreshToken rotates a refresh token: the presented token is invalidated and a
+// new pair is issued for the same session. The user is reloaded so role changes apply.
+func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (_ *auth.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RefreshToken")
+	defer func() { tracing.End(span, err) }()
+	rec, err := s.tokens.ConsumeRefreshToken(ctx, refreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		s.log.WarnContext(ctx, "refresh token reused, session revoked")
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.Repo.GetUserByID(ctx, int64(rec.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if user == nil {
+		return nil, auth.ErrInvalidToken
 	}
+	tokens, err := s.tokens.IssueTokensForSession(ctx, subjectOf(user), rec.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	return tokens, nil
+}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Hour * 72).Unix(),
-	})
-	tokenString, err := token.SignedString(jwtSecret)
+// Logout revokes the caller's access token and the session it belongs to
+func (s *UserService) Logout(ctx context.Context, claims *auth.Claims) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Logout")
+	defer func() { tracing.End(span, err) }()
+	return s.tokens.Revoke(ctx, claims)
+}
+
+// JWKS returns the public keys that verify the tokens issued by LoginUser
+func (s *UserService) JWKS() auth.JWKS {
+	return s.tokens.JWKS()
+}
+
+func subjectOf(user *userModel.User) auth.Subject {
+	return auth.Subject{ID: user.ID, Name: user.Name, Email: user.Email, Role: user.Role}
+}
+
+// UpdateUser applies a profile update and returns the updated user. An update
+// that changes nothing writes nothing: no audit entry and no event.
+func (s *UserService) UpdateUser(ctx context.Context, id int64, update UserUpdate) (_ *userModel.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateUser", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	if update.Name == nil && update.Email == nil {
+		return found(s.Repo.GetUserByID(ctx, id))
+	}
+	uow, err := s.txManager.Begin(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
+	defer uow.Rollback() // Rollback if any error occurs
 
-	return tokenString, nil
+	// The row stays locked until the commit, so concurrent updates can not
+	// overwrite each other or record a stale "before" in the audit log
+	user, err := found(uow.UserRepo().GetUserByIDForUpdate(ctx, id))
+	if err != nil {
+		return nil, err
+	}
+	before := auditModel.Snapshot(user)
+	if (update.Name == nil || *update.Name == user.Name) && (update.Email == nil || *update.Email == user.Email) {
+		return user, nil
+	}
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+	if err := uow.UserRepo().UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionUpdate, id, before, auditModel.Snapshot(user)); err != nil {
+		return nil, err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserUpdated, id, outboxModel.UserUpdated{
+		UserID: id,
+		Name:   user.Name,
+		Email:  user.Email,
+	}); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func (s *UserService) UpdateUser(user *userModel.User) error {
-	return s.Repo.UpdateUser(user)
+// ChangePassword stores a new password hash after checking the current
+// password, then revokes every session of the user
+func (s *UserService) ChangePassword(ctx context.Context, id int64, currentPassword, newPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ChangePassword", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return s.setPassword(ctx, id, &currentPassword, newPassword)
 }
 
-func (s *UserService) DeleteUser(id int64) error {
-	return s.Repo.DeleteUser(id)
+// ResetPassword stores a new password hash without the current password, for
+// an administrator resetting another user's password, then revokes every
+// session of the user
+func (s *UserService) ResetPassword(ctx context.Context, id int64, newPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ResetPassword", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	return s.setPassword(ctx, id, nil, newPassword)
 }
 
-func (s *UserService) RegisterUserWithOrder(user *userModel.User, order *orderModel.Order) error {
-	uow, err := s.txManager.Begin()
+// setPassword replaces the password hash, checking currentPassword first
+// unless it is nil
+func (s *UserService) setPassword(ctx context.Context, id int64, currentPassword *string, newPassword string) error {
+	uow, err := s.txManager.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer uow.Rollback() // Rollback if any error occurs
 
-	if err := uow.UserRepo().CreateUser(user); err != nil {
+	user, err := found(uow.UserRepo().GetUserByID(ctx, id))
+	if err != nil {
+		return err
+	}
+	if currentPassword != nil && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(*currentPassword)) != nil {
+		s.log.WarnContext(ctx, "password change rejected", "user_id", id)
+		return userModel.ErrIncorrectPassword
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := uow.UserRepo().UpdatePassword(ctx, id, hash); err != nil {
+		return err
+	}
+	// The hashes only show up as redacted, the entry records that the password changed
+	if err := recordUser(ctx, uow, auditModel.ActionChangePassword, id,
+		map[string]any{"password": user.Password}, map[string]any{"password": hash}); err != nil {
+		return err
+	}
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "password changed", "user_id", id, "reset", currentPassword == nil)
+	// Sessions opened with the old password must not outlive it. The password
+	// is already changed, so finish even if the client has gone away.
+	return s.tokens.RevokeUserSessions(context.WithoutCancel(ctx), int(id))
+}
+
+// ChangeRole assigns a policy role to a user and logs out all of their
+// sessions, so no token keeps the old role.
+func (s *UserService) ChangeRole(ctx context.Context, id int64, role string, actorID int64) (_ *userModel.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.ChangeRole", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	if !s.roles.HasRole(role) {
+		return nil, ErrUnknownRole
+	}
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	user, err := found(uow.UserRepo().GetUserByID(ctx, id))
+	if err != nil {
+		return nil, err
+	}
+	from := user.Role
+	if err := uow.UserRepo().UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionChangeRole, id,
+		map[string]any{"role": from}, map[string]any{"role": role}); err != nil {
+		return nil, err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserRoleChanged, id,
+		outboxModel.UserRoleChanged{UserID: id, From: from, To: role}); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "user role changed", "user_id", id, "from", from, "to", role, "actor_id", actorID)
+	// Tokens carry the role, so the ones issued before must not outlive it
+	if err := s.tokens.RevokeUserSessions(context.WithoutCancel(ctx), int(id)); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// DeleteUser soft deletes a user and logs out all of their sessions. Under the
+// restrict policy a user who still has orders is not deleted and
+// ErrUserHasOrders is returned.
+func (s *UserService) DeleteUser(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.DeleteUser", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	user, err := found(uow.UserRepo().GetUserByID(ctx, id))
+	if err != nil {
+		return err
+	}
+	if s.ordersOnDelete != userModel.OrdersCascade {
+		_, orders, err := uow.OrderRepo().ListOrders(ctx, orderModel.OrderFilter{UserID: id, PageSize: 1})
+		if err != nil {
+			return fmt.Errorf("count orders failed: %w", err)
+		}
+		if orders > 0 {
+			return userModel.ErrUserHasOrders
+		}
+	}
+	if err := uow.UserRepo().DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionDelete, id, auditModel.Snapshot(user), nil); err != nil {
+		return err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserDeleted, id, outboxModel.UserDeleted{UserID: id}); err != nil {
+		return err
+	}
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "user deleted", "user_id", id)
+	return s.tokens.RevokeUserSessions(context.WithoutCancel(ctx), int(id))
+}
+
+// RestoreUser undoes the soft delete of a user that has not been purged yet
+func (s *UserService) RestoreUser(ctx context.Context, id int64) (_ *userModel.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RestoreUser", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { tracing.End(span, err) }()
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	if err := uow.UserRepo().RestoreUser(ctx, id); err != nil {
+		return nil, err
+	}
+	user, err := found(uow.UserRepo().GetUserByID(ctx, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionRestore, id, nil, auditModel.Snapshot(user)); err != nil {
+		return nil, err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserRestored, id, outboxModel.UserRestored{UserID: id}); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "user restored", "user_id", id)
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users soft deleted more than retention
+// ago, with their orders under the cascade policy, and returns how many were removed
+func (s *UserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.PurgeDeletedUsers")
+	defer func() { tracing.End(span, err) }()
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	cascade := s.ordersOnDelete == userModel.OrdersCascade
+	purged, err := uow.UserRepo().PurgeDeletedUsers(ctx, time.Now().Add(-retention), cascade)
+	if err != nil {
+		return 0, err
+	}
+	// Cascaded orders are gone for good, so the audit log keeps their last state
+	for _, order := range purged.Orders {
+		if err := recordPurge(ctx, uow, auditModel.EntityOrder, order.ID, auditModel.Snapshot(order)); err != nil {
+			return 0, err
+		}
+		if err := addEvent(ctx, uow, outboxModel.TypeOrderPurged, order.ID,
+			outboxModel.OrderPurged{OrderID: order.ID, UserID: order.UserID}); err != nil {
+			return 0, err
+		}
+	}
+	for _, id := range purged.UserIDs {
+		if err := recordPurge(ctx, uow, auditModel.EntityUser, id, nil); err != nil {
+			return 0, err
+		}
+		if err := addEvent(ctx, uow, outboxModel.TypeUserPurged, id,
+			outboxModel.UserPurged{UserID: id, OrdersPurged: cascade}); err != nil {
+			return 0, err
+		}
+	}
+	if err := uow.Commit(); err != nil {
+		return 0, err
+	}
+	if len(purged.UserIDs) > 0 {
+		s.log.InfoContext(ctx, "deleted users purged", "count", len(purged.UserIDs), "orders", len(purged.Orders), "orders_cascaded", cascade)
+	}
+	return int64(len(purged.UserIDs)), nil
+}
+
+// recordPurge audits the removal of an entity by the purge job
+func recordPurge(ctx context.Context, uow db.UnitOfWork, entity string, id int64, before map[string]any) error {
+	entry := auditModel.NewEntry(ctx, auditModel.ActionPurge, entity, id, before, nil)
+	entry.ActorRole = auditModel.SystemRole
+	return uow.AuditRepo().Record(ctx, entry)
+}
+
+// RunPurge calls PurgeDeletedUsers every interval until ctx is cancelled.
+// Every instance may run it: an advisory lock lets only one purge at a time.
+func (s *UserService) RunPurge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.PurgeDeletedUsers(ctx, retention); err != nil && ctx.Err() == nil {
+			s.log.ErrorContext(ctx, "purging deleted users failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterUserWithOrder stores a new user and their first order in one transaction
+func (s *UserService) RegisterUserWithOrder(ctx context.Context, user *userModel.User, order *orderModel.Order) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.RegisterUserWithOrder")
+	defer func() { tracing.End(span, err) }()
+	if !s.roles.HasRole(user.Role) {
+		return ErrUnknownRole
+	}
+	if err := order.PrepareItems(); err != nil {
+		return err
+	}
+	if user.Password, err = hashPassword(user.Password); err != nil {
+		return err
+	}
+	uow, err := s.txManager.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer uow.Rollback() // Rollback if any error occurs
+
+	if err := uow.UserRepo().CreateUser(ctx, user); err != nil {
+		return err
+	}
+	if err := recordUser(ctx, uow, auditModel.ActionCreate, int64(user.ID), nil, auditModel.Snapshot(user)); err != nil {
+		return err
+	}
+	if err := addEvent(ctx, uow, outboxModel.TypeUserRegistered, int64(user.ID), outboxModel.UserRegistered{
+		UserID:    int64(user.ID),
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}); err != nil {
 		return err
 	}
 
 	order.UserID = int64(user.ID)
-	if err := uow.OrderRepo().CreateOrder(order); err != nil {
+	order.Status = orderModel.OrderStatusPending
+	// The new user is the actor of the order's first status entry
+	if err := orderservice.CreateOrderInTx(ctx, uow, order, int64(user.ID)); err != nil {
 		return err
 	}
 
 	return uow.Commit() // Commit only if all succeed
 }
+
+// recordUser writes the audit entry of a user change on the change's unit of work
+func recordUser(ctx context.Context, uow db.UnitOfWork, action string, id int64, before, after map[string]any) error {
+	return uow.AuditRepo().Record(ctx, auditModel.NewEntry(ctx, action, auditModel.EntityUser, id, before, after))
+}
+
+// addEvent stores a domain event on the unit of work; the relay publishes it
+// once the change has committed
+func addEvent(ctx context.Context, uow db.UnitOfWork, eventType string, id int64, payload any) error {
+	event, err := outboxModel.NewEvent(ctx, eventType, id, payload)
+	if err != nil {
+		return err
+	}
+	return uow.OutboxRepo().Add(ctx, event)
+}
@@ -0,0 +1,215 @@
+// Package validation checks request bodies against the `binding` tags of their
+// DTOs and reports every invalid field at once. Besides the standard validator
+// tags (required, email, min, max, oneof, ...) it provides:
+//   - password: PasswordMinLen to PasswordMaxLen bytes with a letter and a digit
+//   - money: a positive amount up to money.MaxAmount in a supported currency
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go-template/internal/common/apperr"
+	"go-template/pkg/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	PasswordMinLen = 8
+	// bcrypt ignores everything after 72 bytes
+	PasswordMaxLen = 72
+)
+
+var (
+	// ErrInvalidBody is returned when the body is not valid JSON
+	ErrInvalidBody = apperr.Validation("invalid_body", "request body is not valid JSON")
+	// ErrInvalidFields is returned, with every violation in its Fields, when
+	// the body decodes but breaks its validation rules
+	ErrInvalidFields = apperr.Validation("invalid_fields", "request has invalid fields")
+)
+
+var once sync.Once
+
+// register adds the custom tags and reports fields by their JSON names.
+// It runs once, before the first request is validated.
+func register() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("validation: gin is not using go-playground/validator")
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	v.RegisterValidation("password", validPassword)
+	v.RegisterValidation("money", validMoney)
+}
+
+// BindJSON decodes the request body into obj and validates it. The returned
+// error is ErrInvalidBody or ErrInvalidFields listing every invalid field.
+func BindJSON(c *gin.Context, obj any) error {
+	once.Do(register)
+	return bindError(c.ShouldBindJSON(obj))
+}
+
+// BindMergePatch decodes a JSON Merge Patch (RFC 7396) body into obj and
+// validates it. The JSON fields of obj are the allow-list: any other member is
+// reported as not_allowed instead of being ignored, and null, which would
+// remove a member, is reported as not_null. Members absent from the patch
+// leave their pointer fields in obj nil.
+func BindMergePatch(c *gin.Context, obj any) error {
+	once.Do(register)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return ErrInvalidBody.WithCause(err)
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return ErrInvalidBody.WithMessage("merge patch must be a JSON object").WithCause(err)
+	}
+	allowed := jsonFields(reflect.TypeOf(obj).Elem())
+	var fields []apperr.FieldError
+	for name, raw := range members {
+		if !allowed[name] {
+			fields = append(fields, apperr.FieldError{Field: name, Code: "not_allowed", Message: "can not be changed"})
+		} else if string(raw) == "null" {
+			fields = append(fields, apperr.FieldError{Field: name, Code: "not_null", Message: "can not be removed"})
+		}
+	}
+	if len(fields) > 0 {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return ErrInvalidFields.WithFields(fields...)
+	}
+	if err := json.Unmarshal(body, obj); err != nil {
+		return bindError(err)
+	}
+	return bindError(binding.Validator.ValidateStruct(obj))
+}
+
+// jsonFields returns the JSON names of the fields of struct type t
+func jsonFields(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "-" && name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// bindError converts a decoding or validation error to ErrInvalidBody or ErrInvalidFields
+func bindError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make([]apperr.FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			fields = append(fields, apperr.FieldError{
+				Field:   fieldPath(fe),
+				Code:    fe.Tag(),
+				Message: message(fe),
+			})
+		}
+		return ErrInvalidFields.WithFields(fields...)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return ErrInvalidFields.WithFields(apperr.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: "must be " + jsonType(typeErr.Type),
+		})
+	}
+	return ErrInvalidBody.WithCause(err)
+}
+
+// fieldPath drops the struct name from the namespace, e.g.
+// CreateOrderRequest.items[0].price becomes items[0].price
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return path
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min", "max":
+		if fe.Tag() == "min" && fe.Param() == "1" && (fe.Kind() == reflect.String || fe.Kind() == reflect.Slice) {
+			return "must not be empty"
+		}
+		bound := "at least"
+		if fe.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, fe.Param())
+		case reflect.Slice:
+			return fmt.Sprintf("must have %s %s items", bound, fe.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "password":
+		return fmt.Sprintf("must be %d to %d characters long and contain a letter and a digit", PasswordMinLen, PasswordMaxLen)
+	case "money":
+		return fmt.Sprintf("must be a positive amount of at most %d minor units in a supported currency", money.MaxAmount)
+	}
+	return "is invalid"
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+func validPassword(fl validator.FieldLevel) bool {
+	s := fl.Field().String()
+	if len(s) < PasswordMinLen || len(s) > PasswordMaxLen {
+		return false
+	}
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0 && strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
+
+func validMoney(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(money.Money)
+	return ok && m.IsPositive() && m.Amount <= money.MaxAmount && m.Validate() == nil
+}
@@ -0,0 +1,23 @@
+-- Databases set up before versioned migrations already have a "user" table.
+-- The project shipped no schema then, so it was created by hand to fit the
+-- User model and its exact columns may vary. It is adopted and brought to the
+-- same shape instead of failing, so every statement here must be idempotent.
+CREATE TABLE IF NOT EXISTS "user" (
+    "id"        SERIAL PRIMARY KEY,
+    "name"      VARCHAR(255) NOT NULL,
+    "email"     VARCHAR(255) NOT NULL,
+    "password"  VARCHAR(255) NOT NULL,
+    "role"      VARCHAR(32)  NOT NULL DEFAULT 'user',
+    "createdAt" TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS "role" VARCHAR(32);
+UPDATE "user" SET "role" = 'user' WHERE "role" IS NULL OR "role" = '';
+ALTER TABLE "user" ALTER COLUMN "role" SET DEFAULT 'user', ALTER COLUMN "role" SET NOT NULL;
+
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS "createdAt" TIMESTAMPTZ;
+UPDATE "user" SET "createdAt" = now() WHERE "createdAt" IS NULL;
+ALTER TABLE "user" ALTER COLUMN "createdAt" SET DEFAULT now(), ALTER COLUMN "createdAt" SET NOT NULL;
+
+-- Fails if an adopted table holds duplicate emails; merge them first
+CREATE UNIQUE INDEX IF NOT EXISTS "user_email_key" ON "user" ("email");
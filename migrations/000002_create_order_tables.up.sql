@@ -0,0 +1,67 @@
+-- Like 000001, an "order" table created by hand before migrations is adopted.
+-- Its prices are a float "price" in major units without a currency; they are
+-- converted to "priceAmount" minor units in USD (money.DefaultCurrency).
+CREATE TABLE IF NOT EXISTS "order" (
+    "id"            BIGSERIAL PRIMARY KEY,
+    "product"       VARCHAR(255) NOT NULL,
+    "priceAmount"   BIGINT       NOT NULL,
+    "priceCurrency" CHAR(3)      NOT NULL,
+    "userId"        INTEGER      NOT NULL REFERENCES "user" ("id"),
+    "status"        VARCHAR(16)  NOT NULL DEFAULT 'pending'
+        CHECK ("status" IN ('pending', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded')),
+    "createdAt"     TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS "priceAmount" BIGINT;
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS "priceCurrency" CHAR(3);
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS "status" VARCHAR(16) NOT NULL DEFAULT 'pending'
+    CHECK ("status" IN ('pending', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'order' AND column_name = 'price') THEN
+        UPDATE "order"
+        SET "priceAmount" = round("price"::numeric * 100)::bigint, "priceCurrency" = 'USD'
+        WHERE "priceAmount" IS NULL;
+        ALTER TABLE "order" DROP COLUMN "price";
+    END IF;
+    -- Adopted tables have no foreign key; NOT VALID leaves existing rows unchecked
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = '"order"'::regclass AND contype = 'f') THEN
+        ALTER TABLE "order" ADD CONSTRAINT "order_userId_fkey"
+            FOREIGN KEY ("userId") REFERENCES "user" ("id") NOT VALID;
+    END IF;
+END $$;
+
+ALTER TABLE "order" ALTER COLUMN "priceAmount" SET NOT NULL, ALTER COLUMN "priceCurrency" SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS "order_userId_idx" ON "order" ("userId");
+CREATE INDEX IF NOT EXISTS "order_createdAt_idx" ON "order" ("createdAt");
+
+CREATE TABLE "order_item" (
+    "id"            BIGSERIAL PRIMARY KEY,
+    "orderId"       BIGINT       NOT NULL REFERENCES "order" ("id") ON DELETE CASCADE,
+    "productId"     BIGINT       NOT NULL DEFAULT 0,
+    "name"          VARCHAR(255) NOT NULL,
+    "quantity"      INTEGER      NOT NULL CHECK ("quantity" > 0),
+    "priceAmount"   BIGINT       NOT NULL,
+    "priceCurrency" CHAR(3)      NOT NULL
+);
+
+CREATE INDEX "order_item_orderId_idx" ON "order_item" ("orderId");
+
+CREATE TABLE "order_status_history" (
+    "id"         BIGSERIAL PRIMARY KEY,
+    "orderId"    BIGINT      NOT NULL REFERENCES "order" ("id") ON DELETE CASCADE,
+    "fromStatus" VARCHAR(16) NOT NULL DEFAULT '',
+    "toStatus"   VARCHAR(16) NOT NULL,
+    "actorId"    INTEGER     NOT NULL,
+    "changedAt"  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "order_status_history_orderId_idx" ON "order_status_history" ("orderId");
+
+-- Adopted orders get the initial history entry new orders are created with
+INSERT INTO "order_status_history" ("orderId", "toStatus", "actorId", "changedAt")
+SELECT "id", "status", "userId", "createdAt" FROM "order";
@@ -0,0 +1,3 @@
+DROP INDEX "user_role_idx";
+DROP INDEX "user_name_id_idx";
+DROP INDEX "user_createdAt_id_idx";
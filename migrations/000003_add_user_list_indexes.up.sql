@@ -0,0 +1,4 @@
+-- Keyset pagination of GET /users walks these (column, id) pairs
+CREATE INDEX "user_createdAt_id_idx" ON "user" ("createdAt", "id");
+CREATE INDEX "user_name_id_idx" ON "user" ("name", "id");
+CREATE INDEX "user_role_idx" ON "user" ("role");
@@ -0,0 +1,5 @@
+-- Users that are still soft deleted become active again
+DROP INDEX "user_deletedAt_idx";
+DROP INDEX "user_email_key";
+CREATE UNIQUE INDEX "user_email_key" ON "user" ("email");
+ALTER TABLE "user" DROP COLUMN "deletedAt";
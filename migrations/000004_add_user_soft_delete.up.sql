@@ -0,0 +1,9 @@
+ALTER TABLE "user" ADD COLUMN "deletedAt" TIMESTAMPTZ;
+
+-- The email of a deleted user can be registered again. Restoring the deleted
+-- user then fails with email_taken.
+DROP INDEX "user_email_key";
+CREATE UNIQUE INDEX "user_email_key" ON "user" ("email") WHERE "deletedAt" IS NULL;
+
+-- Lets the purge find expired users without scanning the table
+CREATE INDEX "user_deletedAt_idx" ON "user" ("deletedAt") WHERE "deletedAt" IS NOT NULL;
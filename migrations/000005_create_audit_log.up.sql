@@ -0,0 +1,28 @@
+CREATE TABLE "audit_log" (
+    "id"        BIGSERIAL PRIMARY KEY,
+    "at"        TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    "actorId"   BIGINT       NOT NULL DEFAULT 0,
+    "actorRole" VARCHAR(64)  NOT NULL DEFAULT '',
+    "action"    VARCHAR(32)  NOT NULL,
+    "entity"    VARCHAR(32)  NOT NULL,
+    "entityId"  BIGINT       NOT NULL,
+    "ip"        VARCHAR(64)  NOT NULL DEFAULT '',
+    "userAgent" VARCHAR(512) NOT NULL DEFAULT '',
+    "requestId" VARCHAR(128) NOT NULL DEFAULT '',
+    "changes"   JSONB        NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX "audit_log_entity_idx" ON "audit_log" ("entity", "entityId", "id");
+CREATE INDEX "audit_log_actorId_idx" ON "audit_log" ("actorId", "id");
+CREATE INDEX "audit_log_at_idx" ON "audit_log" ("at");
+
+-- The audit log is append-only: rows can be inserted but never changed or removed
+CREATE FUNCTION "audit_log_append_only"() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "audit_log_append_only"
+    BEFORE UPDATE OR DELETE ON "audit_log"
+    FOR EACH ROW EXECUTE FUNCTION "audit_log_append_only"();
@@ -0,0 +1,21 @@
+CREATE TABLE "outbox" (
+    "id"            BIGSERIAL PRIMARY KEY,
+    "eventId"       VARCHAR(32)  NOT NULL UNIQUE,
+    "type"          VARCHAR(64)  NOT NULL,
+    "aggregate"     VARCHAR(32)  NOT NULL,
+    "aggregateId"   BIGINT       NOT NULL,
+    "payload"       JSONB        NOT NULL,
+    "requestId"     VARCHAR(128) NOT NULL DEFAULT '',
+    "occurredAt"    TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    "status"        VARCHAR(16)  NOT NULL DEFAULT 'pending'
+        CHECK ("status" IN ('pending', 'published', 'dead')),
+    "attempts"      INTEGER      NOT NULL DEFAULT 0,
+    "nextAttemptAt" TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    "lastError"     TEXT         NOT NULL DEFAULT '',
+    "publishedAt"   TIMESTAMPTZ
+);
+
+-- The relay only looks at pending events that are due, oldest first
+CREATE INDEX "outbox_pending_idx" ON "outbox" ("nextAttemptAt", "id") WHERE "status" = 'pending';
+-- Lets the relay delete published events past their retention
+CREATE INDEX "outbox_publishedAt_idx" ON "outbox" ("publishedAt") WHERE "status" = 'published';
@@ -0,0 +1 @@
+DROP INDEX "user_email_id_idx";
@@ -0,0 +1,3 @@
+-- Keyset pagination of GET /users?sort=email walks (email, id) like the
+-- other sorts in 000003
+CREATE INDEX "user_email_id_idx" ON "user" ("email", "id");
@@ -0,0 +1,10 @@
+// Package migrations embeds the versioned SQL schema migrations.
+//
+// Each migration is a pair of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Create new ones with `go run ./cmd/migrate create NAME`.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,137 @@
+// Package money represents monetary amounts exactly, as an integer number of
+// minor units (e.g. cents) of an ISO 4217 currency.
+//
+// Rounding rules: amounts are accepted, stored and added in minor units, so
+// line totals (unit price × quantity) and order totals are exact and never
+// rounded. Add and Mul return ErrOverflow instead of wrapping around.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount out of range")
+)
+
+// DefaultCurrency is used when a request does not specify one
+const DefaultCurrency = "USD"
+
+// MaxAmount is the largest amount accepted as input, in minor units.
+// It leaves room for line totals and order totals far below the int64 range.
+const MaxAmount = 1_000_000_000_000
+
+// currencyDigits maps supported ISO 4217 codes to their number of minor unit digits
+var currencyDigits = map[string]int{
+	"AUD": 2, "BHD": 3, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2,
+	"HKD": 2, "JPY": 0, "KRW": 0, "KWD": 3, "NZD": 2, "SGD": 2, "TWD": 2, "USD": 2,
+}
+
+// Money is an amount in minor units of a currency.
+// The GORM column tags let it be embedded with a prefix, e.g.
+// `gorm:"embedded;embeddedPrefix:price"` gives "priceAmount" and "priceCurrency".
+type Money struct {
+	// Amount in minor units of the currency (e.g. cents for USD)
+	Amount int64 `json:"amount" gorm:"column:Amount" example:"1999"`
+	// ISO 4217 currency code
+	Currency string `json:"currency" gorm:"column:Currency" example:"USD"`
+}
+
+// New returns an amount in minor units of currency
+func New(amount int64, currency string) (Money, error) {
+	if !IsValidCurrency(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// IsValidCurrency reports whether currency is a supported ISO 4217 code
+func IsValidCurrency(currency string) bool {
+	_, ok := currencyDigits[currency]
+	return ok
+}
+
+// Digits returns the number of minor unit digits of a currency
+func Digits(currency string) int {
+	return currencyDigits[currency]
+}
+
+// Validate checks the currency is supported
+func (m Money) Validate() error {
+	if !IsValidCurrency(m.Currency) {
+		return fmt.Errorf("%w: %q", ErrUnknownCurrency, m.Currency)
+	}
+	return nil
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Add returns m + o; both must be in the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) ||
+		(o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrOverflow, m, o)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by a whole quantity; the result is exact or ErrOverflow
+func (m Money) Mul(quantity int64) (Money, error) {
+	if mulOverflows(m.Amount, quantity) {
+		return Money{}, fmt.Errorf("%w: %s × %d", ErrOverflow, m, quantity)
+	}
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}, nil
+}
+
+// mulOverflows reports whether a*b is outside the int64 range
+func mulOverflows(a, b int64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	if (a > 0) == (b > 0) {
+		// Positive product
+		if a > 0 {
+			return a > math.MaxInt64/b
+		}
+		return a < math.MaxInt64/b
+	}
+	// Negative product
+	if a > 0 {
+		return b < math.MinInt64/a
+	}
+	return a < math.MinInt64/b
+}
+
+// Decimal formats the amount in major units, e.g. "19.99"
+func (m Money) Decimal() string {
+	digits := Digits(m.Currency)
+	if digits == 0 {
+		return fmt.Sprintf("%d", m.Amount)
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(1)
+	for i := 0; i < digits; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, digits, amount%scale)
+}
+
+// String formats the amount with its currency, e.g. "19.99 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
@@ -0,0 +1,81 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func usd(amount int64) Money {
+	return Money{Amount: amount, Currency: "USD"}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"sum", usd(1999), usd(1), usd(2000), nil},
+		{"negative", usd(-5), usd(3), usd(-2), nil},
+		{"up to the maximum", usd(math.MaxInt64 - 1), usd(1), usd(math.MaxInt64), nil},
+		{"down to the minimum", usd(math.MinInt64 + 1), usd(-1), usd(math.MinInt64), nil},
+		{"overflow", usd(math.MaxInt64), usd(1), Money{}, ErrOverflow},
+		{"underflow", usd(math.MinInt64), usd(-1), Money{}, ErrOverflow},
+		{"currency mismatch", usd(1), Money{Amount: 1, Currency: "EUR"}, Money{}, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: %v + %v = %v, %v; want %v, %v", tt.name, tt.a, tt.b, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		quantity int64
+		want     Money
+		err      error
+	}{
+		{"line total", usd(1999), 3, usd(5997), nil},
+		{"zero quantity", usd(1999), 0, usd(0), nil},
+		{"zero amount", usd(0), math.MaxInt64, usd(0), nil},
+		{"negative amount", usd(-7), 3, usd(-21), nil},
+		{"largest order line", usd(MaxAmount), 10000, usd(MaxAmount * 10000), nil},
+		{"up to the maximum", usd(math.MaxInt64 / 2), 2, usd(math.MaxInt64 - 1), nil},
+		{"down to the minimum", usd(math.MinInt64 / 2), 2, usd(math.MinInt64), nil},
+		{"overflow", usd(math.MaxInt64/2 + 1), 2, Money{}, ErrOverflow},
+		{"both negative overflow", usd(math.MinInt64 / 2), -2, Money{}, ErrOverflow},
+		{"negative quantity underflow", usd(math.MaxInt64), -2, Money{}, ErrOverflow},
+		{"minimum times -1", usd(math.MinInt64), -1, Money{}, ErrOverflow},
+		{"large quantity", usd(2), math.MaxInt64, Money{}, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Mul(tt.quantity)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: %v × %d = %v, %v; want %v, %v", tt.name, tt.m, tt.quantity, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{usd(1999), "19.99"},
+		{usd(5), "0.05"},
+		{usd(-150), "-1.50"},
+		{Money{Amount: 500, Currency: "JPY"}, "500"},
+		{Money{Amount: 1234, Currency: "KWD"}, "1.234"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
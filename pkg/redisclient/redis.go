@@ -2,44 +2,61 @@ package redisclient
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"os"
+	"errors"
+	"log/slog"
 
-	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
-var Rdb *redis.Client
+// ErrDisabled is returned by the Ping probe when Redis was unavailable at startup
+var ErrDisabled = errors.New("redis disabled: unavailable at startup")
 
-func Init() {
-	// Load .env if exists
-	_ = godotenv.Load()
+// Options are the connection settings passed to New
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+}
 
-	host := os.Getenv("REDIS_HOST")
-	if host == "" {
-		host = "127.0.0.1"
-	}
+// New connects to Redis. It returns nil when Redis is unreachable; callers
+// then run without it (no cache, in-memory token state).
+func New(opts Options) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
 
-	port := os.Getenv("REDIS_PORT")
-	if port == "" {
-		port = "6379"
+	// Trace every Redis command
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		slog.Warn("Redis tracing unavailable", "error", err)
 	}
 
-	password := os.Getenv("REDIS_PASSWORD")
-
-	addr := fmt.Sprintf("%s:%s", host, port)
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		slog.Warn("Redis unavailable, caching disabled", "addr", opts.Addr, "error", err)
+		rdb.Close()
+		return nil
+	}
+	slog.Info("Redis connected", "addr", opts.Addr)
+	return rdb
+}
 
-	Rdb = redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       0,
-	})
+// Ping returns a readiness probe for rdb. New returns nil when Redis was
+// unreachable at startup, in which case the probe reports ErrDisabled.
+func Ping(rdb *redis.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if rdb == nil {
+			return ErrDisabled
+		}
+		return rdb.Ping(ctx).Err()
+	}
+}
 
-	if _, err := Rdb.Ping(context.Background()).Result(); err != nil {
-		log.Printf("⚠️ Redis unavailable: %v", err)
-		Rdb = nil
-	} else {
-		log.Println("✅ Redis connected successfully")
+// Close closes rdb, if New connected one
+func Close(rdb *redis.Client) error {
+	if rdb == nil {
+		return nil
 	}
+	return rdb.Close()
 }